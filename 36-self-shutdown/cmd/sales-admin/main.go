@@ -14,8 +14,10 @@ import (
 	"time"
 
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/blob"
 	"github.com/a2go/garagesale/internal/platform/conf"
 	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/product"
 	"github.com/a2go/garagesale/internal/schema"
 	"github.com/a2go/garagesale/internal/user"
 	"github.com/pkg/errors"
@@ -41,6 +43,13 @@ func run() error {
 			Name       string `conf:"default:postgres"`
 			DisableTLS bool   `conf:"default:false"`
 		}
+		Images struct {
+			Dir  string `conf:"default:images"`
+			Path string `conf:"default:/v1/images"`
+		}
+		Purge struct {
+			Retention time.Duration `conf:"default:720h"`
+		}
 		Args conf.Args
 	}
 
@@ -75,6 +84,8 @@ func run() error {
 		err = useradd(dbConfig, cfg.Args.Num(1), cfg.Args.Num(2))
 	case "keygen":
 		err = keygen(cfg.Args.Num(1))
+	case "purge":
+		err = purge(dbConfig, cfg.Images.Dir, cfg.Images.Path, cfg.Purge.Retention)
 	default:
 		err = errors.New("Must specify a command")
 	}
@@ -158,6 +169,33 @@ func useradd(cfg database.Config, email, password string) error {
 	return nil
 }
 
+// purge permanently removes products which have been in the trash for longer
+// than the retention period along with their image files.
+func purge(cfg database.Config, imageDir, imagePath string, retention time.Duration) error {
+	if retention <= 0 {
+		return errors.New("purge retention must be positive")
+	}
+
+	images, err := blob.NewLocal(imageDir, imagePath)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := product.Purge(context.Background(), db, images, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Purged %d products deleted more than %v ago\n", n, retention)
+	return nil
+}
+
 // keygen creates an x509 private key for signing auth tokens.
 func keygen(path string) error {
 	if path == "" {
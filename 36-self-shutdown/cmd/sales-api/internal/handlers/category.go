@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a2go/garagesale/internal/category"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Categories defines all of the handlers related to categories. It holds the
+// application state needed by the handler methods.
+type Categories struct {
+	db *sqlx.DB
+}
+
+// categoryParams are the URL path parameters which identify a category.
+type categoryParams struct {
+	ID string `path:"id" validate:"uuid"`
+}
+
+// List gets all categories from the service layer.
+func (c *Categories) List(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Categories.List")
+	defer span.End()
+
+	list, err := category.List(ctx, c.db)
+	if err != nil {
+		return errors.Wrap(err, "getting category list")
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
+// Retrieve finds a single category identified by an ID in the request URL.
+func (c *Categories) Retrieve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Categories.Retrieve")
+	defer span.End()
+
+	var params categoryParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	cat, err := category.Get(ctx, c.db, params.ID)
+	if err != nil {
+		return errors.Wrapf(err, "getting category %q", params.ID)
+	}
+
+	return web.Respond(ctx, w, cat, http.StatusOK)
+}
+
+// Create decodes the body of a request to create a new category. The full
+// category with generated fields is sent back in the response.
+func (c *Categories) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Categories.Create")
+	defer span.End()
+
+	var nc category.NewCategory
+	if err := web.Decode(r, &nc); err != nil {
+		return errors.Wrap(err, "decoding new category")
+	}
+
+	cat, err := category.Create(ctx, c.db, nc, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "creating new category")
+	}
+
+	return web.Respond(ctx, w, cat, http.StatusCreated)
+}
+
+// Update decodes the body of a request to update an existing category. The ID
+// of the category is part of the request URL.
+func (c *Categories) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Categories.Update")
+	defer span.End()
+
+	var params categoryParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	var update category.UpdateCategory
+	if err := web.Decode(r, &update); err != nil {
+		return errors.Wrap(err, "decoding category update")
+	}
+
+	if err := category.Update(ctx, c.db, params.ID, update, time.Now()); err != nil {
+		return errors.Wrapf(err, "updating category %q", params.ID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// Delete removes a single category identified by an ID in the request URL.
+func (c *Categories) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Categories.Delete")
+	defer span.End()
+
+	var params categoryParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	if err := category.Delete(ctx, c.db, params.ID); err != nil {
+		return errors.Wrapf(err, "deleting category %q", params.ID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
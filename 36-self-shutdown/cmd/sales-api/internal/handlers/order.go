@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a2go/garagesale/internal/order"
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Orders defines all of the handlers related to orders. It holds the
+// application state needed by the handler methods.
+type Orders struct {
+	db *sqlx.DB
+}
+
+// orderParams are the URL path parameters which identify an order.
+type orderParams struct {
+	ID string `path:"id" validate:"uuid"`
+}
+
+// Create decodes the body of a request to record a new order. The full order
+// with its lines is sent back in the response.
+func (o *Orders) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Orders.Create")
+	defer span.End()
+
+	var no order.NewOrder
+	if err := web.Decode(r, &no); err != nil {
+		return errors.Wrap(err, "decoding new order")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	ord, err := order.Create(ctx, o.db, claims, no, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "creating new order")
+	}
+
+	return web.Respond(ctx, w, ord, http.StatusCreated)
+}
+
+// Retrieve finds a single order identified by an ID in the request URL.
+func (o *Orders) Retrieve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Orders.Retrieve")
+	defer span.End()
+
+	ord, err := o.get(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, ord, http.StatusOK)
+}
+
+// Receipt gives the receipt for a single order identified by an ID in the
+// request URL. Clients which accept text/plain get it laid out for printing.
+func (o *Orders) Receipt(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Orders.Receipt")
+	defer span.End()
+
+	ord, err := o.get(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, ord.Receipt(), http.StatusOK)
+}
+
+// get finds the order identified by the request URL on behalf of the user
+// making the request.
+func (o *Orders) get(ctx context.Context, r *http.Request) (*order.Order, error) {
+	var params orderParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return nil, errors.Wrap(err, "decoding path parameters")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return nil, errors.New("claims missing from context")
+	}
+
+	ord, err := order.Get(ctx, o.db, claims, params.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting order %q", params.ID)
+	}
+
+	return ord, nil
+}
@@ -2,14 +2,17 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/blob"
+	"github.com/a2go/garagesale/internal/platform/database"
 	"github.com/a2go/garagesale/internal/platform/web"
 	"github.com/a2go/garagesale/internal/product"
-	"github.com/go-chi/chi"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
@@ -20,18 +23,124 @@ import (
 type Products struct {
 	db  *sqlx.DB
 	log *log.Logger
+
+	// images stores uploaded product images which may be up to
+	// maxImageBytes long.
+	images        blob.Store
+	maxImageBytes int64
+}
+
+// productParams are the URL path parameters which identify a product.
+type productParams struct {
+	ID string `path:"id" validate:"uuid"`
+}
+
+// imageParams are the URL path parameters which identify an image of a
+// product.
+type imageParams struct {
+	ID      string `path:"id" validate:"uuid"`
+	ImageID string `path:"image_id" validate:"uuid"`
+}
+
+// saleParams are the URL path parameters which identify a sale of a
+// product.
+type saleParams struct {
+	ID     string `path:"id" validate:"uuid"`
+	SaleID string `path:"sale_id" validate:"uuid"`
+}
+
+// pageParams are the query parameters which select a page of a listing. The
+// after cursor comes from the Link header of the previous page.
+type pageParams struct {
+	Limit int              `query:"limit" validate:"min=1,max=100"`
+	After *database.Cursor `query:"after"`
+}
+
+// asOfParams are the query parameters which select a past state of a
+// product.
+type asOfParams struct {
+	At *time.Time `query:"at"`
+}
+
+// searchParams are the query parameters of a product search.
+type searchParams struct {
+	Query string `query:"q" validate:"required,max=200"`
 }
 
-// List gets all products from the service layer.
+// defaultPageLimit is how many items are listed when no limit is requested.
+const defaultPageLimit = 50
+
+// List streams a page of products from the service layer. Query parameters
+// can filter and sort the products as described by product.Filter.
 func (s *Products) List(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := trace.StartSpan(ctx, "handlers.Product.List")
 	defer span.End()
 
-	list, err := product.List(ctx, s.db)
+	filter, page, err := decodeListing(r)
+	if err != nil {
+		return err
+	}
+
+	rows, next, err := product.StreamList(ctx, s.db, filter, page)
 	if err != nil {
 		return errors.Wrap(err, "getting product list")
 	}
 
+	if next != nil {
+		setNextLink(w, r, next)
+	}
+
+	return web.RespondStream(ctx, w, rows, http.StatusOK)
+}
+
+// Trash gets a page of deleted products. It takes the same query parameters
+// as List.
+func (s *Products) Trash(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.Trash")
+	defer span.End()
+
+	filter, page, err := decodeListing(r)
+	if err != nil {
+		return err
+	}
+
+	list, next, err := product.ListTrash(ctx, s.db, filter, page)
+	if err != nil {
+		return errors.Wrap(err, "getting product trash")
+	}
+
+	if next != nil {
+		setNextLink(w, r, next)
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
+// Search gets a page of the products which match the text in the q query
+// parameter, best matches first. It is paged the same way as List.
+func (s *Products) Search(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.Search")
+	defer span.End()
+
+	var search searchParams
+	if err := web.DecodeQuery(r, &search); err != nil {
+		return errors.Wrap(err, "decoding query parameters")
+	}
+
+	page := pageParams{Limit: defaultPageLimit}
+	if err := web.DecodeQuery(r, &page); err != nil {
+		return errors.Wrap(err, "decoding query parameters")
+	}
+
+	list, next, err := product.Search(ctx, s.db, search.Query, database.Page{Limit: page.Limit, After: page.After})
+	if err != nil {
+		return errors.Wrapf(err, "searching products for %q", search.Query)
+	}
+
+	if next != nil {
+		setNextLink(w, r, next)
+	}
+
 	return web.Respond(ctx, w, list, http.StatusOK)
 }
 
@@ -60,34 +169,76 @@ func (s *Products) Create(ctx context.Context, w http.ResponseWriter, r *http.Re
 }
 
 // Retrieve finds a single product identified by an ID in the request URL.
+// When the at query parameter holds an RFC 3339 time the product is rebuilt
+// from its history as it was at that time.
 func (s *Products) Retrieve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := trace.StartSpan(ctx, "handlers.Products.Retrieve")
 	defer span.End()
 
-	id := chi.URLParam(r, "id")
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
 
-	p, err := product.Get(ctx, s.db, id)
-	if err != nil {
-		switch err {
-		case product.ErrNotFound:
-			return web.NewRequestError(err, http.StatusNotFound)
-		case product.ErrInvalidID:
-			return web.NewRequestError(err, http.StatusBadRequest)
-		default:
-			return errors.Wrapf(err, "getting product %q", id)
+	var asOf asOfParams
+	if err := web.DecodeQuery(r, &asOf); err != nil {
+		return errors.Wrap(err, "decoding query parameters")
+	}
+
+	if asOf.At != nil {
+		p, err := product.AsOf(ctx, s.db, params.ID, *asOf.At)
+		if err != nil {
+			return errors.Wrapf(err, "getting product %q as of %v", params.ID, *asOf.At)
 		}
+		return web.Respond(ctx, w, p, http.StatusOK)
+	}
+
+	p, err := product.Get(ctx, s.db, params.ID)
+	if err != nil {
+		return errors.Wrapf(err, "getting product %q", params.ID)
 	}
 
 	return web.Respond(ctx, w, p, http.StatusOK)
 }
 
+// History gets a page of the changes made to a particular product, oldest
+// first.
+func (s *Products) History(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.History")
+	defer span.End()
+
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	page := pageParams{Limit: defaultPageLimit}
+	if err := web.DecodeQuery(r, &page); err != nil {
+		return errors.Wrap(err, "decoding query parameters")
+	}
+
+	list, next, err := product.History(ctx, s.db, params.ID, database.Page{Limit: page.Limit, After: page.After})
+	if err != nil {
+		return errors.Wrap(err, "getting product history")
+	}
+
+	if next != nil {
+		setNextLink(w, r, next)
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
 // Update decodes the body of a request to update an existing product. The ID
 // of the product is part of the request URL.
 func (s *Products) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := trace.StartSpan(ctx, "handlers.Products.Update")
 	defer span.End()
 
-	id := chi.URLParam(r, "id")
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
 
 	var update product.UpdateProduct
 	if err := web.Decode(r, &update); err != nil {
@@ -99,17 +250,8 @@ func (s *Products) Update(ctx context.Context, w http.ResponseWriter, r *http.Re
 		return errors.New("claims missing from context")
 	}
 
-	if err := product.Update(ctx, s.db, claims, id, update, time.Now()); err != nil {
-		switch err {
-		case product.ErrNotFound:
-			return web.NewRequestError(err, http.StatusNotFound)
-		case product.ErrInvalidID:
-			return web.NewRequestError(err, http.StatusBadRequest)
-		case product.ErrForbidden:
-			return web.NewRequestError(err, http.StatusForbidden)
-		default:
-			return errors.Wrapf(err, "updating product %q", id)
-		}
+	if err := product.Update(ctx, s.db, claims, params.ID, update, time.Now()); err != nil {
+		return errors.Wrapf(err, "updating product %q", params.ID)
 	}
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
@@ -120,15 +262,41 @@ func (s *Products) Delete(ctx context.Context, w http.ResponseWriter, r *http.Re
 	ctx, span := trace.StartSpan(ctx, "handlers.Products.Delete")
 	defer span.End()
 
-	id := chi.URLParam(r, "id")
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
 
-	if err := product.Delete(ctx, s.db, id); err != nil {
-		switch err {
-		case product.ErrInvalidID:
-			return web.NewRequestError(err, http.StatusBadRequest)
-		default:
-			return errors.Wrapf(err, "deleting product %q", id)
-		}
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := product.Delete(ctx, s.db, claims, params.ID, time.Now()); err != nil {
+		return errors.Wrapf(err, "deleting product %q", params.ID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// Restore takes a single product identified by an ID in the request URL out
+// of the trash.
+func (s *Products) Restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.Restore")
+	defer span.End()
+
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := product.Restore(ctx, s.db, claims, params.ID, time.Now()); err != nil {
+		return errors.Wrapf(err, "restoring product %q", params.ID)
 	}
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
@@ -145,9 +313,17 @@ func (s *Products) AddSale(ctx context.Context, w http.ResponseWriter, r *http.R
 		return errors.Wrap(err, "decoding new sale")
 	}
 
-	productID := chi.URLParam(r, "id")
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
 
-	sale, err := product.AddSale(ctx, s.db, ns, productID, time.Now())
+	sale, err := product.AddSale(ctx, s.db, claims, ns, params.ID, time.Now())
 	if err != nil {
 		return errors.Wrap(err, "adding new sale")
 	}
@@ -155,17 +331,202 @@ func (s *Products) AddSale(ctx context.Context, w http.ResponseWriter, r *http.R
 	return web.Respond(ctx, w, sale, http.StatusCreated)
 }
 
-// ListSales gets all sales for a particular product.
+// ListSales streams a page of sales for a particular product.
 func (s *Products) ListSales(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := trace.StartSpan(ctx, "handlers.Products.ListSales")
 	defer span.End()
 
-	id := chi.URLParam(r, "id")
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
 
-	list, err := product.ListSales(ctx, s.db, id)
+	page := pageParams{Limit: defaultPageLimit}
+	if err := web.DecodeQuery(r, &page); err != nil {
+		return errors.Wrap(err, "decoding query parameters")
+	}
+
+	rows, next, err := product.StreamSales(ctx, s.db, params.ID, database.Page{Limit: page.Limit, After: page.After})
 	if err != nil {
 		return errors.Wrap(err, "getting sales list")
 	}
 
+	if next != nil {
+		setNextLink(w, r, next)
+	}
+
+	return web.RespondStream(ctx, w, rows, http.StatusOK)
+}
+
+// AddRefund gives back part of a particular sale of a product. It looks for
+// a JSON object in the request body. The full refund is returned to the
+// caller.
+func (s *Products) AddRefund(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.AddRefund")
+	defer span.End()
+
+	var params saleParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	var nr product.NewRefund
+	if err := web.Decode(r, &nr); err != nil {
+		return errors.Wrap(err, "decoding new refund")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	refund, err := product.AddRefund(ctx, s.db, claims, nr, params.ID, params.SaleID, time.Now())
+	if err != nil {
+		return errors.Wrapf(err, "refunding sale %q of product %q", params.SaleID, params.ID)
+	}
+
+	return web.Respond(ctx, w, refund, http.StatusCreated)
+}
+
+// ListRefunds gets all refunds of a particular sale of a product.
+func (s *Products) ListRefunds(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.ListRefunds")
+	defer span.End()
+
+	var params saleParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	list, err := product.ListRefunds(ctx, s.db, params.ID, params.SaleID)
+	if err != nil {
+		return errors.Wrap(err, "getting refund list")
+	}
+
 	return web.Respond(ctx, w, list, http.StatusOK)
 }
+
+// VoidSale cancels a particular sale of a product. The reason is given in a
+// JSON object in the request body.
+func (s *Products) VoidSale(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.VoidSale")
+	defer span.End()
+
+	var params saleParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	var v product.Void
+	if err := web.Decode(r, &v); err != nil {
+		return errors.Wrap(err, "decoding void")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := product.VoidSale(ctx, s.db, claims, v, params.ID, params.SaleID, time.Now()); err != nil {
+		return errors.Wrapf(err, "voiding sale %q of product %q", params.SaleID, params.ID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// AddImage stores an image for a particular product. It looks for the file
+// in the image field of a multipart/form-data request body. The image with
+// its URLs is returned to the caller.
+func (s *Products) AddImage(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.AddImage")
+	defer span.End()
+
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	f, err := web.DecodeFile(r, "image", s.maxImageBytes)
+	if err != nil {
+		return errors.Wrap(err, "decoding image upload")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	img, err := product.AddImage(ctx, s.db, s.images, claims, params.ID, f.Data, time.Now())
+	if err != nil {
+		return errors.Wrapf(err, "adding image %q to product %q", f.Name, params.ID)
+	}
+
+	return web.Respond(ctx, w, img, http.StatusCreated)
+}
+
+// ListImages gets all images of a particular product.
+func (s *Products) ListImages(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.ListImages")
+	defer span.End()
+
+	var params productParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	list, err := product.ListImages(ctx, s.db, params.ID)
+	if err != nil {
+		return errors.Wrap(err, "getting image list")
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
+// DeleteImage removes a single image of a product. Both are identified by
+// IDs in the request URL.
+func (s *Products) DeleteImage(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Products.DeleteImage")
+	defer span.End()
+
+	var params imageParams
+	if err := web.DecodeParams(r, &params); err != nil {
+		return errors.Wrap(err, "decoding path parameters")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := product.DeleteImage(ctx, s.db, s.images, claims, params.ID, params.ImageID); err != nil {
+		return errors.Wrapf(err, "deleting image %q of product %q", params.ImageID, params.ID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// decodeListing reads the filter and page for a product listing from the
+// query string.
+func decodeListing(r *http.Request) (product.Filter, database.Page, error) {
+	page := pageParams{Limit: defaultPageLimit}
+	if err := web.DecodeQuery(r, &page); err != nil {
+		return product.Filter{}, database.Page{}, errors.Wrap(err, "decoding query parameters")
+	}
+
+	var filter product.Filter
+	if err := web.DecodeQuery(r, &filter); err != nil {
+		return product.Filter{}, database.Page{}, errors.Wrap(err, "decoding query parameters")
+	}
+
+	return filter, database.Page{Limit: page.Limit, After: page.After}, nil
+}
+
+// setNextLink adds a Link header which points to the page following the one
+// in the response. Other query parameters are carried over unchanged.
+func setNextLink(w http.ResponseWriter, r *http.Request, next *database.Cursor) {
+	q := r.URL.Query()
+	q.Set("after", next.String())
+
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, u.String()))
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/a2go/garagesale/internal/report"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Reports defines all of the handlers related to sales reports. It holds the
+// application state needed by the handler methods.
+type Reports struct {
+	db *sqlx.DB
+}
+
+// Revenue totals the amount paid for sales in buckets of time, for each
+// currency separately. Query parameters filter and bucket the sales as
+// described by report.Filter.
+func (rp *Reports) Revenue(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Reports.Revenue")
+	defer span.End()
+
+	return rp.respond(ctx, w, r, report.Revenue)
+}
+
+// Units totals the number of units sold in buckets of time. It takes the same
+// query parameters as Revenue.
+func (rp *Reports) Units(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(ctx, "handlers.Reports.Units")
+	defer span.End()
+
+	return rp.respond(ctx, w, r, report.Units)
+}
+
+// respond decodes the report filter from the query string and responds with
+// the buckets made by run.
+func (rp *Reports) respond(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	run func(ctx context.Context, db *sqlx.DB, user auth.Claims, f report.Filter) ([]report.Bucket, error)) error {
+
+	var filter report.Filter
+	if err := web.DecodeQuery(r, &filter); err != nil {
+		return errors.Wrap(err, "decoding query parameters")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	buckets, err := run(ctx, rp.db, claims, filter)
+	if err != nil {
+		return errors.Wrap(err, "running report")
+	}
+
+	return web.Respond(ctx, w, buckets, http.StatusOK)
+}
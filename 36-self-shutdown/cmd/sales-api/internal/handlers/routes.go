@@ -5,17 +5,64 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/a2go/garagesale/internal/category"
 	"github.com/a2go/garagesale/internal/mid"
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/blob"
+	"github.com/a2go/garagesale/internal/platform/ratelimit"
 	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/a2go/garagesale/internal/product"
 	"github.com/jmoiron/sqlx"
 )
 
+// Config holds the settings from the service configuration which control how
+// the API handles requests.
+type Config struct {
+
+	// MaxBodyBytes is the largest request body accepted. Zero means no limit.
+	MaxBodyBytes int64
+
+	// CORS controls which browser origins may call the API.
+	CORS mid.CORSConfig
+
+	// RateStore holds rate limit state. When nil it is kept in memory.
+	RateStore ratelimit.Store
+
+	// TokenLimit restricts how often each IP address may request a token.
+	TokenLimit ratelimit.Limit
+
+	// APILimit restricts how often each user may call the product routes.
+	APILimit ratelimit.Limit
+
+	// Images stores uploaded product images. When nil the image routes are
+	// not registered. When it is also an http.Handler, as blob.Local is, it
+	// serves the images under ImagePath.
+	Images    blob.Store
+	ImagePath string
+
+	// MaxImageBytes is the largest image which can be uploaded. Zero means
+	// defaultMaxImageBytes.
+	MaxImageBytes int64
+}
+
+// defaultMaxImageBytes is the upload limit used when Config does not set
+// one.
+const defaultMaxImageBytes = 5 << 20
+
+// multipartOverhead allows for the form encoding around an uploaded file
+// when limiting the size of the request body.
+const multipartOverhead = 64 << 10
+
 // API constructs an http.Handler with all application routes defined.
-func API(shutdown chan os.Signal, db *sqlx.DB, log *log.Logger, authenticator *auth.Authenticator) http.Handler {
+func API(shutdown chan os.Signal, db *sqlx.DB, log *log.Logger, authenticator *auth.Authenticator, cfg Config) http.Handler {
+
+	store := cfg.RateStore
+	if store == nil {
+		store = ratelimit.NewMemory()
+	}
 
 	// Construct the web.App which holds all routes as well as common Middleware.
-	app := web.NewApp(shutdown, log, mid.Logger(log), mid.Errors(log), mid.Metrics(), mid.Panics(log))
+	app := web.NewApp(shutdown, log, mid.Logger(log), mid.Compress(1024), mid.Errors(log), mid.Metrics(), mid.Panics(log), mid.CORS(cfg.CORS), mid.BodyLimit(cfg.MaxBodyBytes))
 
 	{
 		// Register health check handler. This route is not authenticated.
@@ -29,21 +76,82 @@ func API(shutdown chan os.Signal, db *sqlx.DB, log *log.Logger, authenticator *a
 
 		// The token route can't be authenticated because they need this route to
 		// get the token in the first place.
-		app.Handle(http.MethodGet, "/v1/users/token", u.Token)
+		// It is limited by IP address because every call checks a password.
+		app.Handle(http.MethodGet, "/v1/users/token", u.Token, mid.RateLimit(store, "token", cfg.TokenLimit))
 	}
 
 	{
-		// Register Product handlers. Ensure all routes are authenticated.
-		p := Products{db: db, log: log}
+		// Register Product handlers. Ensure all routes are authenticated. Who
+		// may act on a particular product is decided by product.Policy.
+		maxImageBytes := cfg.MaxImageBytes
+		if maxImageBytes <= 0 {
+			maxImageBytes = defaultMaxImageBytes
+		}
+		p := Products{db: db, log: log, images: cfg.Images, maxImageBytes: maxImageBytes}
+
+		g := app.Group("/v1/products", mid.Authenticate(authenticator), mid.RateLimit(store, "products", cfg.APILimit))
+		g.Handle(http.MethodGet, "", p.List)
+		g.Handle(http.MethodGet, "/search", p.Search)
+		g.Handle(http.MethodGet, "/trash", p.Trash, mid.Authorize(product.Policy, product.ActionListTrash))
+		g.Handle(http.MethodGet, "/{id}", p.Retrieve)
+		g.Handle(http.MethodPost, "", p.Create)
+		g.Handle(http.MethodPut, "/{id}", p.Update)
+		g.Handle(http.MethodDelete, "/{id}", p.Delete)
+		g.Handle(http.MethodGet, "/{id}/history", p.History)
+		g.Handle(http.MethodPost, "/{id}/restore", p.Restore, mid.Authorize(product.Policy, product.ActionRestore))
 
-		app.Handle(http.MethodGet, "/v1/products", p.List, mid.Authenticate(authenticator))
-		app.Handle(http.MethodGet, "/v1/products/{id}", p.Retrieve, mid.Authenticate(authenticator))
-		app.Handle(http.MethodPost, "/v1/products", p.Create, mid.Authenticate(authenticator))
-		app.Handle(http.MethodPut, "/v1/products/{id}", p.Update, mid.Authenticate(authenticator))
-		app.Handle(http.MethodDelete, "/v1/products/{id}", p.Delete, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		g.Handle(http.MethodPost, "/{id}/sales", p.AddSale)
+		g.Handle(http.MethodGet, "/{id}/sales", p.ListSales)
+		g.Handle(http.MethodPost, "/{id}/sales/{sale_id}/refunds", p.AddRefund)
+		g.Handle(http.MethodGet, "/{id}/sales/{sale_id}/refunds", p.ListRefunds)
+		g.Handle(http.MethodPost, "/{id}/sales/{sale_id}/void", p.VoidSale)
+
+		// Uploads are larger than other request bodies so they get their own
+		// limit. The images themselves can be fetched without a token so they
+		// work in plain <img> tags.
+		if cfg.Images != nil {
+			g.Handle(http.MethodPost, "/{id}/images", p.AddImage, mid.BodyLimit(maxImageBytes+multipartOverhead))
+			g.Handle(http.MethodGet, "/{id}/images", p.ListImages)
+			g.Handle(http.MethodDelete, "/{id}/images/{image_id}", p.DeleteImage)
+
+			if files, ok := cfg.Images.(http.Handler); ok && cfg.ImagePath != "" {
+				app.Mount(cfg.ImagePath, http.StripPrefix(cfg.ImagePath, files))
+			}
+		}
+	}
+
+	{
+		// Register Category handlers. Any user can read categories but
+		// category.Policy decides who may change them.
+		c := Categories{db: db}
+
+		g := app.Group("/v1/categories", mid.Authenticate(authenticator), mid.RateLimit(store, "categories", cfg.APILimit))
+		g.Handle(http.MethodGet, "", c.List)
+		g.Handle(http.MethodGet, "/{id}", c.Retrieve)
+		g.Handle(http.MethodPost, "", c.Create, mid.Authorize(category.Policy, category.ActionCreate))
+		g.Handle(http.MethodPut, "/{id}", c.Update, mid.Authorize(category.Policy, category.ActionUpdate))
+		g.Handle(http.MethodDelete, "/{id}", c.Delete, mid.Authorize(category.Policy, category.ActionDelete))
+	}
+
+	{
+		// Register Order handlers. Who may sell the products in an order is
+		// decided by product.Policy and who may see it by order.Policy.
+		o := Orders{db: db}
+
+		g := app.Group("/v1/orders", mid.Authenticate(authenticator), mid.RateLimit(store, "orders", cfg.APILimit))
+		g.Handle(http.MethodPost, "", o.Create)
+		g.Handle(http.MethodGet, "/{id}", o.Retrieve)
+		g.Handle(http.MethodGet, "/{id}/receipt", o.Receipt)
+	}
+
+	{
+		// Register report handlers. Users see reports on their own products
+		// and admins on anyone's, as decided by report.Policy.
+		rp := Reports{db: db}
 
-		app.Handle(http.MethodPost, "/v1/products/{id}/sales", p.AddSale, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
-		app.Handle(http.MethodGet, "/v1/products/{id}/sales", p.ListSales, mid.Authenticate(authenticator))
+		g := app.Group("/v1/reports", mid.Authenticate(authenticator), mid.RateLimit(store, "reports", cfg.APILimit))
+		g.Handle(http.MethodGet, "/revenue", rp.Revenue)
+		g.Handle(http.MethodGet, "/units", rp.Units)
 	}
 
 	return app
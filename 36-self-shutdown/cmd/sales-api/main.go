@@ -16,9 +16,12 @@ import (
 
 	"contrib.go.opencensus.io/exporter/zipkin"
 	"github.com/a2go/garagesale/cmd/sales-api/internal/handlers"
+	"github.com/a2go/garagesale/internal/mid"
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/blob"
 	"github.com/a2go/garagesale/internal/platform/conf"
 	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/platform/ratelimit"
 	jwt "github.com/dgrijalva/jwt-go"
 	openzipkin "github.com/openzipkin/zipkin-go"
 	zipkinHTTP "github.com/openzipkin/zipkin-go/reporter/http"
@@ -50,6 +53,26 @@ func run() error {
 			ReadTimeout     time.Duration `conf:"default:5s"`
 			WriteTimeout    time.Duration `conf:"default:5s"`
 			ShutdownTimeout time.Duration `conf:"default:5s"`
+			MaxBodyBytes    int64         `conf:"default:1048576"`
+			CORS            struct {
+				AllowedOrigins   []string `conf:"default:http://localhost:8080"`
+				AllowedMethods   []string
+				AllowedHeaders   []string
+				ExposedHeaders   []string      `conf:"default:Link"`
+				AllowCredentials bool          `conf:"default:false"`
+				MaxAge           time.Duration `conf:"default:10m"`
+			}
+			RateLimit struct {
+				TokenRequests int           `conf:"default:10"`
+				TokenPer      time.Duration `conf:"default:1m"`
+				APIRequests   int           `conf:"default:300"`
+				APIPer        time.Duration `conf:"default:1m"`
+			}
+		}
+		Images struct {
+			Dir      string `conf:"default:images"`
+			Path     string `conf:"default:/v1/images"`
+			MaxBytes int64  `conf:"default:5242880"`
 		}
 		DB struct {
 			User       string `conf:"default:postgres"`
@@ -121,6 +144,14 @@ func run() error {
 	}
 	defer db.Close()
 
+	// =========================================================================
+	// Start Image Storage
+
+	images, err := blob.NewLocal(cfg.Images.Dir, cfg.Images.Path)
+	if err != nil {
+		return errors.Wrap(err, "opening image storage")
+	}
+
 	// =========================================================================
 	// Start Tracing Support
 
@@ -156,9 +187,42 @@ func run() error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	apiConfig := handlers.Config{
+		MaxBodyBytes: cfg.Web.MaxBodyBytes,
+		CORS: mid.CORSConfig{
+			AllowedOrigins:   cfg.Web.CORS.AllowedOrigins,
+			AllowedMethods:   cfg.Web.CORS.AllowedMethods,
+			AllowedHeaders:   cfg.Web.CORS.AllowedHeaders,
+			ExposedHeaders:   cfg.Web.CORS.ExposedHeaders,
+			AllowCredentials: cfg.Web.CORS.AllowCredentials,
+			MaxAge:           cfg.Web.CORS.MaxAge,
+		},
+		TokenLimit: ratelimit.Limit{
+			Requests: cfg.Web.RateLimit.TokenRequests,
+			Per:      cfg.Web.RateLimit.TokenPer,
+		},
+		APILimit: ratelimit.Limit{
+			Requests: cfg.Web.RateLimit.APIRequests,
+			Per:      cfg.Web.RateLimit.APIPer,
+		},
+		Images:        images,
+		ImagePath:     cfg.Images.Path,
+		MaxImageBytes: cfg.Images.MaxBytes,
+	}
+
+	if err := apiConfig.CORS.Validate(); err != nil {
+		return errors.Wrap(err, "checking CORS config")
+	}
+	if err := apiConfig.TokenLimit.Validate(); err != nil {
+		return errors.Wrap(err, "checking token rate limit")
+	}
+	if err := apiConfig.APILimit.Validate(); err != nil {
+		return errors.Wrap(err, "checking API rate limit")
+	}
+
 	api := http.Server{
 		Addr:         cfg.Web.Address,
-		Handler:      handlers.API(shutdown, db, log, authenticator),
+		Handler:      handlers.API(shutdown, db, log, authenticator, apiConfig),
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
 	}
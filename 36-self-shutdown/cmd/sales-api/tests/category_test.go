@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/a2go/garagesale/cmd/sales-api/internal/handlers"
+	"github.com/a2go/garagesale/internal/tests"
+)
+
+// TestCategories runs a series of tests to exercise Category behavior from
+// the API level.
+func TestCategories(t *testing.T) {
+	test := tests.New(t)
+	defer test.Teardown()
+
+	shutdown := make(chan os.Signal, 1)
+	ct := CategoryTests{
+		app:        handlers.API(shutdown, test.DB, test.Log, test.Authenticator, handlers.Config{MaxBodyBytes: 1 << 20}),
+		adminToken: test.Token("admin@example.com", "gophers"),
+		userToken:  test.Token("user@example.com", "gophers"),
+	}
+
+	t.Run("List", ct.List)
+	t.Run("CreateRequiresAdmin", ct.CreateRequiresAdmin)
+	t.Run("CreateAndFilter", ct.CreateAndFilter)
+	t.Run("MoveToRoot", ct.MoveToRoot)
+	t.Run("InvalidID", ct.InvalidID)
+}
+
+// CategoryTests holds methods for each category subtest. This type allows
+// passing dependencies for tests while still providing a convenient syntax
+// when subtests are registered.
+type CategoryTests struct {
+	app        http.Handler
+	adminToken string
+	userToken  string
+}
+
+// List ensures any user can see the seeded categories.
+func (ct *CategoryTests) List(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/categories", nil)
+	req.Header.Set("Authorization", "Bearer "+ct.userToken)
+	resp := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var list []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if exp, got := 3, len(list); exp != got {
+		t.Fatalf("expected category list size %v, got %v", exp, got)
+	}
+}
+
+// CreateRequiresAdmin ensures regular users cannot change the tree.
+func (ct *CategoryTests) CreateRequiresAdmin(t *testing.T) {
+	body := strings.NewReader(`{"name":"Books"}`)
+	req := httptest.NewRequest("POST", "/v1/categories", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ct.userToken)
+	resp := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("posting: expected status code %v, got %v", http.StatusForbidden, resp.Code)
+	}
+}
+
+// CreateAndFilter creates a category under Collectibles, files a product in
+// it and finds the product by filtering on the parent category.
+func (ct *CategoryTests) CreateAndFilter(t *testing.T) {
+	body := strings.NewReader(`{"name":"Stamps","parent_id":"f3a1b2c4-5d6e-4f70-8a9b-0c1d2e3f4a5b"}`)
+	req := httptest.NewRequest("POST", "/v1/categories", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ct.adminToken)
+	resp := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("posting category: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+
+	var created map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+
+	body = strings.NewReader(`{"name":"Penny Black","cost":{"amount":500,"currency":"USD"},"quantity":1,"category_ids":["` + created["id"].(string) + `"]}`)
+	req = httptest.NewRequest("POST", "/v1/products", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ct.adminToken)
+	resp = httptest.NewRecorder()
+
+	ct.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("posting product: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/products?category=f3a1b2c4-5d6e-4f70-8a9b-0c1d2e3f4a5b&name=penny", nil)
+	req.Header.Set("Authorization", "Bearer "+ct.adminToken)
+	resp = httptest.NewRecorder()
+
+	ct.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var list []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if len(list) != 1 || list[0]["name"] != "Penny Black" {
+		t.Fatalf("expected the new product under its parent category, got %v", list)
+	}
+}
+
+// MoveToRoot creates a category under Collectibles and moves it to the top of
+// the tree by clearing its parent.
+func (ct *CategoryTests) MoveToRoot(t *testing.T) {
+	body := strings.NewReader(`{"name":"Coins","parent_id":"f3a1b2c4-5d6e-4f70-8a9b-0c1d2e3f4a5b"}`)
+	req := httptest.NewRequest("POST", "/v1/categories", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ct.adminToken)
+	resp := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("posting category: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+
+	var created map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	url := "/v1/categories/" + created["id"].(string)
+
+	req = httptest.NewRequest("PUT", url, strings.NewReader(`{"parent_id":""}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ct.adminToken)
+	resp = httptest.NewRecorder()
+
+	ct.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("updating category: expected status code %v, got %v", http.StatusNoContent, resp.Code)
+	}
+
+	req = httptest.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+ct.adminToken)
+	resp = httptest.NewRecorder()
+
+	ct.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting category: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var moved map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&moved); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if moved["parent_id"] != nil {
+		t.Fatalf("expected the category at the top of the tree, got parent %v", moved["parent_id"])
+	}
+}
+
+// InvalidID ensures malformed IDs in the path are refused by the handlers,
+// as they are for products, before the database is asked about them.
+func (ct *CategoryTests) InvalidID(t *testing.T) {
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		req := httptest.NewRequest(method, "/v1/categories/not-a-uuid", strings.NewReader(`{"name":"Books"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+ct.adminToken)
+		resp := httptest.NewRecorder()
+
+		ct.app.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status code %v, got %v", method, http.StatusBadRequest, resp.Code)
+		}
+
+		var got struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: decoding: %s", method, err)
+		}
+		if got.Code != "validation_failed" {
+			t.Fatalf("%s: expected code %q, got %q", method, "validation_failed", got.Code)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/a2go/garagesale/cmd/sales-api/internal/handlers"
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/a2go/garagesale/internal/tests"
+)
+
+// TestOrders runs a series of tests to exercise orders from the API level
+// against the seeded products.
+func TestOrders(t *testing.T) {
+	test := tests.New(t)
+	defer test.Teardown()
+
+	shutdown := make(chan os.Signal, 1)
+	ot := OrderTests{
+		app:        handlers.API(shutdown, test.DB, test.Log, test.Authenticator, handlers.Config{MaxBodyBytes: 1 << 20}),
+		adminToken: test.Token("admin@example.com", "gophers"),
+		userToken:  test.Token("user@example.com", "gophers"),
+	}
+
+	t.Run("CreateAndReceipt", ot.CreateAndReceipt)
+	t.Run("DuplicateProduct", ot.DuplicateProduct)
+}
+
+// OrderTests holds methods for each order subtest. This type allows passing
+// dependencies for tests while still providing a convenient syntax when
+// subtests are registered.
+type OrderTests struct {
+	app        http.Handler
+	adminToken string
+	userToken  string
+}
+
+// CreateAndReceipt records an order of two products at a discount, then
+// fetches it and prints its receipt.
+func (ot *OrderTests) CreateAndReceipt(t *testing.T) {
+	body := strings.NewReader(`{
+		"lines": [
+			{"product_id": "a2b0639f-2cc6-44b8-b97b-15d69dbb511e", "quantity": 2},
+			{"product_id": "72f8b983-3eb4-48db-9ed0-e45cc6bd716b", "quantity": 1}
+		],
+		"paid": {"amount": 150, "currency": "USD"}
+	}`)
+	req := httptest.NewRequest("POST", "/v1/orders", body)
+	req.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	resp := httptest.NewRecorder()
+
+	ot.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("posting: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+
+	var created struct {
+		ID    string      `json:"id"`
+		Total money.Money `json:"total"`
+		Lines []struct {
+			Paid money.Money `json:"paid"`
+		} `json:"lines"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if created.Total.Amount != 175 || len(created.Lines) != 2 || created.Lines[0].Paid.Amount != 86 || created.Lines[1].Paid.Amount != 64 {
+		t.Fatalf("expected 150 paid for 175 split 86 and 64, got %+v", created)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/orders/"+created.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+ot.userToken)
+	resp = httptest.NewRecorder()
+
+	ot.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("getting another user's order: expected status code %v, got %v", http.StatusForbidden, resp.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/orders/"+created.ID+"/receipt", nil)
+	req.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	req.Header.Set("Accept", "text/plain")
+	resp = httptest.NewRecorder()
+
+	ot.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting receipt: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	receipt := resp.Body.String()
+	for _, want := range []string{"Comic Books", "McDonalds Toys", "Total   1.75 USD", "Discount  -0.25 USD", "Paid   1.50 USD"} {
+		if !strings.Contains(receipt, want) {
+			t.Fatalf("expected receipt to contain %q, got:\n%s", want, receipt)
+		}
+	}
+}
+
+// DuplicateProduct ensures a product can only be in one line of an order.
+func (ot *OrderTests) DuplicateProduct(t *testing.T) {
+	body := strings.NewReader(`{
+		"lines": [
+			{"product_id": "a2b0639f-2cc6-44b8-b97b-15d69dbb511e", "quantity": 1},
+			{"product_id": "a2b0639f-2cc6-44b8-b97b-15d69dbb511e", "quantity": 1}
+		]
+	}`)
+	req := httptest.NewRequest("POST", "/v1/orders", body)
+	req.Header.Set("Authorization", "Bearer "+ot.adminToken)
+	resp := httptest.NewRecorder()
+
+	ot.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("posting: expected status code %v, got %v", http.StatusBadRequest, resp.Code)
+	}
+
+	var got map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if got["code"] != "duplicate_product" {
+		t.Fatalf("expected code duplicate_product, got %v", got["code"])
+	}
+}
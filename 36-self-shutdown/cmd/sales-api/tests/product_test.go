@@ -1,17 +1,25 @@
 package tests
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	// NOTE: Models should not be imported, we want to test the exact JSON. We
 	// make the comparison process easier using the go-cmp library.
 	"github.com/a2go/garagesale/cmd/sales-api/internal/handlers"
+	"github.com/a2go/garagesale/internal/mid"
 	"github.com/a2go/garagesale/internal/tests"
 	"github.com/google/go-cmp/cmp"
 )
@@ -26,14 +34,41 @@ func TestProducts(t *testing.T) {
 	test := tests.New(t)
 	defer test.Teardown()
 
+	images, cleanup := tests.NewImageStore(t)
+	defer cleanup()
+
 	shutdown := make(chan os.Signal, 1)
+	cfg := handlers.Config{
+		MaxBodyBytes: 1 << 20,
+		CORS: mid.CORSConfig{
+			AllowedOrigins: []string{"http://localhost:8080"},
+			MaxAge:         10 * time.Minute,
+		},
+		Images:    images,
+		ImagePath: "/v1/images",
+	}
 	tests := ProductTests{
-		app:        handlers.API(shutdown, test.DB, test.Log, test.Authenticator),
+		app:        handlers.API(shutdown, test.DB, test.Log, test.Authenticator, cfg),
 		adminToken: test.Token("admin@example.com", "gophers"),
+		userToken:  test.Token("user@example.com", "gophers"),
 	}
 
 	t.Run("List", tests.List)
+	t.Run("ListCSV", tests.ListCSV)
+	t.Run("ListCompressed", tests.ListCompressed)
+	t.Run("ListPaged", tests.ListPaged)
+	t.Run("ListFiltered", tests.ListFiltered)
+	t.Run("ListInvalidFilter", tests.ListInvalidFilter)
+	t.Run("Search", tests.Search)
 	t.Run("CreateRequiresFields", tests.CreateRequiresFields)
+	t.Run("RetrieveInvalidID", tests.RetrieveInvalidID)
+	t.Run("CORSPreflight", tests.CORSPreflight)
+	t.Run("AddSaleOversold", tests.AddSaleOversold)
+	t.Run("SalesMissingProduct", tests.SalesMissingProduct)
+	t.Run("RefundAndVoid", tests.RefundAndVoid)
+	t.Run("DeleteNotOwner", tests.DeleteNotOwner)
+	t.Run("History", tests.History)
+	t.Run("Images", tests.Images)
 	t.Run("ProductCRUD", tests.ProductCRUD)
 }
 
@@ -43,6 +78,7 @@ func TestProducts(t *testing.T) {
 type ProductTests struct {
 	app        http.Handler
 	adminToken string
+	userToken  string
 }
 
 func (p *ProductTests) List(t *testing.T) {
@@ -66,24 +102,30 @@ func (p *ProductTests) List(t *testing.T) {
 		{
 			"id":           "a2b0639f-2cc6-44b8-b97b-15d69dbb511e",
 			"name":         "Comic Books",
-			"cost":         float64(50),
+			"cost":         map[string]interface{}{"amount": float64(50), "currency": "USD"},
 			"quantity":     float64(42),
-			"revenue":      float64(350),
+			"revenue":      map[string]interface{}{"amount": float64(350), "currency": "USD"},
 			"sold":         float64(7),
 			"user_id":      "00000000-0000-0000-0000-000000000000",
 			"date_created": "2019-01-01T00:00:01.000001Z",
 			"date_updated": "2019-01-01T00:00:01.000001Z",
+			"categories":   []interface{}{"0e6f1a2b-3c4d-4e5f-9a6b-7c8d9e0f1a2b"},
+			"tags":         []interface{}{"vintage"},
+			"images":       []interface{}{},
 		},
 		{
 			"id":           "72f8b983-3eb4-48db-9ed0-e45cc6bd716b",
 			"name":         "McDonalds Toys",
-			"cost":         float64(75),
+			"cost":         map[string]interface{}{"amount": float64(75), "currency": "USD"},
 			"quantity":     float64(120),
-			"revenue":      float64(225),
+			"revenue":      map[string]interface{}{"amount": float64(225), "currency": "USD"},
 			"sold":         float64(3),
 			"user_id":      "00000000-0000-0000-0000-000000000000",
 			"date_created": "2019-01-01T00:00:02.000001Z",
 			"date_updated": "2019-01-01T00:00:02.000001Z",
+			"categories":   []interface{}{"9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"},
+			"tags":         []interface{}{},
+			"images":       []interface{}{},
 		},
 	}
 
@@ -92,6 +134,241 @@ func (p *ProductTests) List(t *testing.T) {
 	}
 }
 
+func (p *ProductTests) ListCSV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/products", nil)
+	resp := httptest.NewRecorder()
+
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	req.Header.Set("Accept", "text/csv")
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("expected text/csv content type, got %q", ct)
+	}
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+
+	want := [][]string{
+		{"id", "name", "cost", "quantity", "sold", "revenue", "user_id", "date_created", "date_updated", "categories", "tags", "images", "deleted_at"},
+		{"a2b0639f-2cc6-44b8-b97b-15d69dbb511e", "Comic Books", "0.50 USD", "42", "7", "3.50 USD", "00000000-0000-0000-0000-000000000000", "2019-01-01T00:00:01.000001Z", "2019-01-01T00:00:01.000001Z", "[0e6f1a2b-3c4d-4e5f-9a6b-7c8d9e0f1a2b]", "[vintage]", "[]", ""},
+		{"72f8b983-3eb4-48db-9ed0-e45cc6bd716b", "McDonalds Toys", "0.75 USD", "120", "3", "2.25 USD", "00000000-0000-0000-0000-000000000000", "2019-01-01T00:00:02.000001Z", "2019-01-01T00:00:02.000001Z", "[9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d]", "[]", "[]", ""},
+	}
+
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Fatalf("Response did not match expected. Diff:\n%s", diff)
+	}
+}
+
+func (p *ProductTests) ListCompressed(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/products", nil)
+	resp := httptest.NewRecorder()
+
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	if ce := resp.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("expected gzip content encoding, got %q", ce)
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("reading gzip: %s", err)
+	}
+
+	var list []map[string]interface{}
+	if err := json.NewDecoder(zr).Decode(&list); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if exp, got := 2, len(list); exp != got {
+		t.Fatalf("expected product list size %v, got %v", exp, got)
+	}
+}
+
+// ListPaged follows the next links through the product list one product at a
+// time.
+func (p *ProductTests) ListPaged(t *testing.T) {
+	var names []string
+
+	url := "/v1/products?limit=1"
+	for url != "" {
+		req := httptest.NewRequest("GET", url, nil)
+		resp := httptest.NewRecorder()
+
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+
+		p.app.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("getting %s: expected status code %v, got %v", url, http.StatusOK, resp.Code)
+		}
+
+		var list []map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		for _, item := range list {
+			names = append(names, item["name"].(string))
+		}
+
+		url = ""
+		if link := resp.Header().Get("Link"); link != "" {
+			if !strings.HasSuffix(link, `>; rel="next"`) {
+				t.Fatalf("unexpected Link header %q", link)
+			}
+			url = strings.TrimPrefix(strings.TrimSuffix(link, `>; rel="next"`), "<")
+		}
+	}
+
+	want := []string{"Comic Books", "McDonalds Toys"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("Paged names did not match expected. Diff:\n%s", diff)
+	}
+
+	// A cursor from one listing is refused by another.
+	req := httptest.NewRequest("GET", "/v1/products?limit=1&sort=name", nil)
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	link := strings.TrimSuffix(resp.Header().Get("Link"), `>; rel="next"`)
+	i := strings.Index(link, "after=")
+	if i < 0 {
+		t.Fatalf("expected a next link with a cursor, got %q", link)
+	}
+	after := strings.SplitN(link[i:], "&", 2)[0]
+
+	req = httptest.NewRequest("GET", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales?"+after, nil)
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	resp = httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("listing sales after a product cursor: expected status code %v, got %v", http.StatusBadRequest, resp.Code)
+	}
+	var got map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if got["code"] != "invalid_cursor" {
+		t.Fatalf("expected error code %q, got %v", "invalid_cursor", got["code"])
+	}
+}
+
+// ListFiltered ensures query parameters filter and sort the product list.
+func (p *ProductTests) ListFiltered(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/products?name=toys&sort=-cost", nil)
+	resp := httptest.NewRecorder()
+
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var list []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if exp, got := 1, len(list); exp != got {
+		t.Fatalf("expected product list size %v, got %v", exp, got)
+	}
+	if exp, got := "McDonalds Toys", list[0]["name"]; exp != got {
+		t.Fatalf("expected product %q, got %v", exp, got)
+	}
+}
+
+// ListInvalidFilter ensures bad filters are reported against the parameter
+// which caused them.
+func (p *ProductTests) ListInvalidFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		field string
+	}{
+		{"min_cost=cheap", "min_cost"},
+		{"sort=password_hash", "sort"},
+		{"created_after=yesterday", "created_after"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/products?"+tt.query, nil)
+		resp := httptest.NewRecorder()
+
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+
+		p.app.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status code %v, got %v", tt.query, http.StatusBadRequest, resp.Code)
+		}
+
+		var got struct {
+			Fields []map[string]interface{} `json:"fields"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		if len(got.Fields) != 1 || got.Fields[0]["field"] != tt.field {
+			t.Fatalf("%s: expected an error for field %q, got %v", tt.query, tt.field, got.Fields)
+		}
+	}
+}
+
+// Search finds products by the words in their names.
+func (p *ProductTests) Search(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/products/search?q=comics", nil)
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("searching: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var list []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if len(list) != 1 || list[0]["name"] != "Comic Books" {
+		t.Fatalf("expected only Comic Books, got %v", list)
+	}
+	if got, want := list[0]["snippet"], "<mark>Comic</mark> Books"; got != want {
+		t.Fatalf("expected snippet %q, got %q", want, got)
+	}
+	if rank, ok := list[0]["rank"].(float64); !ok || rank <= 0 {
+		t.Fatalf("expected a positive rank, got %v", list[0]["rank"])
+	}
+
+	// A search needs some text.
+	req = httptest.NewRequest("GET", "/v1/products/search", nil)
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	resp = httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("searching without text: expected status code %v, got %v", http.StatusBadRequest, resp.Code)
+	}
+}
+
 func (p *ProductTests) CreateRequiresFields(t *testing.T) {
 	body := strings.NewReader(`{}`)
 	req := httptest.NewRequest("POST", "/v1/products", body)
@@ -108,11 +385,398 @@ func (p *ProductTests) CreateRequiresFields(t *testing.T) {
 	}
 }
 
+// AddSaleOversold ensures a sale for more units than remain is refused.
+func (p *ProductTests) AddSaleOversold(t *testing.T) {
+	body := strings.NewReader(`{"quantity":1000,"paid":{"amount":100,"currency":"USD"}}`)
+	req := httptest.NewRequest("POST", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales", body)
+
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("posting: expected status code %v, got %v", http.StatusConflict, resp.Code)
+	}
+
+	var got map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if got["code"] != "insufficient_stock" {
+		t.Fatalf("expected error code %q, got %v", "insufficient_stock", got["code"])
+	}
+}
+
+// SalesMissingProduct ensures sales cannot be added or listed for a product
+// which does not exist.
+func (p *ProductTests) SalesMissingProduct(t *testing.T) {
+	const url = "/v1/products/2bd3b2e5-c4a3-4a38-9e79-3f7fe8d0d0a5/sales"
+
+	requests := []*http.Request{
+		httptest.NewRequest("GET", url, nil),
+		httptest.NewRequest("POST", url, strings.NewReader(`{"quantity":1,"paid":{"amount":10,"currency":"USD"}}`)),
+	}
+
+	for _, req := range requests {
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected status code %v, got %v", req.Method, http.StatusNotFound, resp.Code)
+		}
+	}
+}
+
+// RefundAndVoid refunds part of a sale and then voids it, checking the
+// product totals after each. Only the owner or an admin may refund a sale.
+func (p *ProductTests) RefundAndVoid(t *testing.T) {
+	do := func(method, url, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		return resp
+	}
+	decode := func(resp *httptest.ResponseRecorder) map[string]interface{} {
+		var got map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		return got
+	}
+
+	resp := do("POST", "/v1/products", `{"name":"Board Games","cost":{"amount":20,"currency":"USD"},"quantity":4}`, p.userToken)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("posting product: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+	url := "/v1/products/" + decode(resp)["id"].(string)
+
+	resp = do("POST", url+"/sales", `{"quantity":2,"paid":{"amount":40,"currency":"USD"}}`, p.userToken)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("posting sale: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+	sale := url + "/sales/" + decode(resp)["id"].(string)
+
+	totals := func(sold, revenue float64) {
+		t.Helper()
+
+		resp := do("GET", url, "", p.userToken)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("getting product: expected status code %v, got %v", http.StatusOK, resp.Code)
+		}
+		got := decode(resp)
+		want := map[string]interface{}{"amount": revenue, "currency": "USD"}
+		if got["sold"] != sold || !cmp.Equal(got["revenue"], want) {
+			t.Fatalf("expected %v sold for %v, got %v sold for %v", sold, revenue, got["sold"], got["revenue"])
+		}
+	}
+
+	resp = do("POST", sale+"/refunds", `{"quantity":1,"amount":{"amount":20,"currency":"USD"},"reason":"box was damaged"}`, p.userToken)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("posting refund: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+	if got := decode(resp); got["reason"] != "box was damaged" || got["user_id"] != "45b5fbd3-755f-4379-8f07-a58d4a30fa2f" {
+		t.Fatalf("expected the refund to record who made it and why, got %v", got)
+	}
+	totals(1, 20)
+
+	resp = do("POST", sale+"/void", `{"reason":"entered by mistake"}`, p.adminToken)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("voiding sale: expected status code %v, got %v", http.StatusNoContent, resp.Code)
+	}
+	totals(0, 0)
+
+	resp = do("POST", sale+"/refunds", `{"quantity":1,"reason":"again"}`, p.userToken)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("refunding a voided sale: expected status code %v, got %v", http.StatusConflict, resp.Code)
+	}
+	if got := decode(resp); got["code"] != "sale_voided" {
+		t.Fatalf("expected error code %q, got %v", "sale_voided", got["code"])
+	}
+
+	// The seeded sales are of products the user does not own.
+	resp = do("POST", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales/98b6d4b8-f04b-4c79-8c2e-a0aef46854b7/refunds", `{"quantity":1,"reason":"not mine"}`, p.userToken)
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("refunding another user's sale: expected status code %v, got %v", http.StatusForbidden, resp.Code)
+	}
+}
+
+// DeleteNotOwner ensures a user cannot delete a product they do not own.
+func (p *ProductTests) DeleteNotOwner(t *testing.T) {
+	req := httptest.NewRequest("DELETE", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e", nil)
+	req.Header.Set("Authorization", "Bearer "+p.userToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("deleting: expected status code %v, got %v", http.StatusForbidden, resp.Code)
+	}
+}
+
+// History lists the changes made to a product and rebuilds it as it was
+// before its sales.
+func (p *ProductTests) History(t *testing.T) {
+	const url = "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+
+	req := httptest.NewRequest("GET", url+"/history", nil)
+	req.Header.Set("Authorization", "Bearer "+p.userToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting history: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var history []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if len(history) != 1 || history[0]["action"] != "create" || history[0]["version"] != float64(1) {
+		t.Fatalf("expected only the create version, got %v", history)
+	}
+	want := map[string]interface{}{"from": nil, "to": "Comic Books"}
+	if diff := cmp.Diff(want, history[0]["changes"].(map[string]interface{})["name"]); diff != "" {
+		t.Fatalf("name change did not match expected. Diff:\n%s", diff)
+	}
+
+	req = httptest.NewRequest("GET", url+"?at=2019-01-01T00:00:02Z", nil)
+	req.Header.Set("Authorization", "Bearer "+p.userToken)
+	resp = httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting past product: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var past map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&past); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if past["name"] != "Comic Books" || !cmp.Equal(past["cost"], map[string]interface{}{"amount": float64(50), "currency": "USD"}) || past["sold"] != float64(0) {
+		t.Fatalf("expected Comic Books costing 50 with nothing sold, got %v", past)
+	}
+
+	// The product did not exist yet at the start of the day.
+	req = httptest.NewRequest("GET", url+"?at=2019-01-01T00:00:00Z", nil)
+	req.Header.Set("Authorization", "Bearer "+p.userToken)
+	resp = httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("getting product before it existed: expected status code %v, got %v", http.StatusNotFound, resp.Code)
+	}
+}
+
+// Images uploads an image for a product, fetches it and its thumbnail and
+// then deletes it.
+func (p *ProductTests) Images(t *testing.T) {
+	const url = "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/images"
+
+	upload := func(data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("image", "cover.png")
+		if err != nil {
+			t.Fatalf("creating form: %s", err)
+		}
+		fw.Write(data)
+		mw.Close()
+
+		req := httptest.NewRequest("POST", url, &body)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+		return resp
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 300, 150))); err != nil {
+		t.Fatalf("encoding png: %s", err)
+	}
+
+	var created map[string]interface{}
+
+	{ // UPLOAD
+		resp := upload(img.Bytes())
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("uploading: expected status code %v, got %v: %s", http.StatusCreated, resp.Code, resp.Body)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+
+		want := map[string]interface{}{
+			"id":            created["id"],
+			"product_id":    "a2b0639f-2cc6-44b8-b97b-15d69dbb511e",
+			"url":           created["url"],
+			"thumbnail_url": created["thumbnail_url"],
+			"content_type":  "image/png",
+			"size":          float64(img.Len()),
+			"width":         float64(300),
+			"height":        float64(150),
+			"date_created":  created["date_created"],
+		}
+		if diff := cmp.Diff(want, created); diff != "" {
+			t.Fatalf("Response did not match expected. Diff:\n%s", diff)
+		}
+	}
+
+	{ // FETCH
+		for _, u := range []interface{}{created["url"], created["thumbnail_url"]} {
+			req := httptest.NewRequest("GET", u.(string), nil)
+			resp := httptest.NewRecorder()
+
+			p.app.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("fetching %s: expected status code %v, got %v", u, http.StatusOK, resp.Code)
+			}
+		}
+
+		req := httptest.NewRequest("GET", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e", nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		var fetched map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&fetched); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		images, ok := fetched["images"].([]interface{})
+		if !ok || len(images) != 1 {
+			t.Fatalf("expected the product to have 1 image, got %v", fetched["images"])
+		}
+		got := images[0].(map[string]interface{})
+		if got["id"] != created["id"] || got["thumbnail_url"] != created["thumbnail_url"] {
+			t.Fatalf("expected the uploaded image on the product, got %v", got)
+		}
+	}
+
+	{ // REJECT
+		if resp := upload([]byte("not an image")); resp.Code != http.StatusUnsupportedMediaType {
+			t.Fatalf("uploading text: expected status code %v, got %v", http.StatusUnsupportedMediaType, resp.Code)
+		}
+
+		req := httptest.NewRequest("POST", url, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+p.userToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusUnsupportedMediaType {
+			t.Fatalf("uploading JSON: expected status code %v, got %v", http.StatusUnsupportedMediaType, resp.Code)
+		}
+	}
+
+	{ // DELETE
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("%s/%s", url, created["id"]), nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusNoContent {
+			t.Fatalf("deleting: expected status code %v, got %v", http.StatusNoContent, resp.Code)
+		}
+
+		req = httptest.NewRequest("GET", created["url"].(string), nil)
+		resp = httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("fetching deleted image: expected status code %v, got %v", http.StatusNotFound, resp.Code)
+		}
+	}
+}
+
+func (p *ProductTests) RetrieveInvalidID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/products/not-a-uuid", nil)
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusBadRequest, resp.Code)
+	}
+
+	var got map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+
+	want := map[string]interface{}{
+		"error": "field validation error",
+		"code":  "validation_failed",
+		"fields": []interface{}{
+			map[string]interface{}{"field": "id", "error": "id must be a valid UUID"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Response did not match expected. Diff:\n%s", diff)
+	}
+}
+
+func (p *ProductTests) CORSPreflight(t *testing.T) {
+	req := httptest.NewRequest("OPTIONS", "/v1/products", nil)
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("preflight: expected status code %v, got %v", http.StatusNoContent, resp.Code)
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "http://localhost:8080",
+		"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, HEAD",
+		"Access-Control-Allow-Headers": "Accept, Accept-Language, Authorization, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+	for k, v := range want {
+		if got := resp.Header().Get(k); got != v {
+			t.Fatalf("preflight: expected %s %q, got %q", k, v, got)
+		}
+	}
+
+	// Origins which are not configured get no CORS headers.
+	req.Header.Set("Origin", "http://evil.example.com")
+	resp = httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if got := resp.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("preflight: expected no allowed origin, got %q", got)
+	}
+}
+
 func (p *ProductTests) ProductCRUD(t *testing.T) {
 	var created map[string]interface{}
 
 	{ // CREATE
-		body := strings.NewReader(`{"name":"product0","cost":55,"quantity":6}`)
+		body := strings.NewReader(`{"name":"product0","cost":{"amount":55,"currency":"USD"},"quantity":6,"category_ids":["9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"],"tags":["Garage"]}`)
 
 		req := httptest.NewRequest("POST", "/v1/products", body)
 		req.Header.Set("Content-Type", "application/json")
@@ -144,11 +808,14 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 			"date_created": created["date_created"],
 			"date_updated": created["date_updated"],
 			"name":         "product0",
-			"cost":         float64(55),
+			"cost":         map[string]interface{}{"amount": float64(55), "currency": "USD"},
 			"quantity":     float64(6),
 			"sold":         float64(0),
-			"revenue":      float64(0),
+			"revenue":      map[string]interface{}{"amount": float64(0), "currency": "USD"},
 			"user_id":      tests.AdminID,
+			"categories":   []interface{}{"9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"},
+			"tags":         []interface{}{"garage"},
+			"images":       []interface{}{},
 		}
 
 		if diff := cmp.Diff(want, created); diff != "" {
@@ -181,7 +848,7 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 	}
 
 	{ // UPDATE
-		body := strings.NewReader(`{"name":"new name","cost":20,"quantity":10}`)
+		body := strings.NewReader(`{"name":"new name","cost":{"amount":20,"currency":"USD"},"quantity":10}`)
 		url := fmt.Sprintf("/v1/products/%s", created["id"])
 		req := httptest.NewRequest("PUT", url, body)
 		req.Header.Set("Content-Type", "application/json")
@@ -216,11 +883,14 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 			"date_created": created["date_created"],
 			"date_updated": updated["date_updated"],
 			"name":         "new name",
-			"cost":         float64(20),
+			"cost":         map[string]interface{}{"amount": float64(20), "currency": "USD"},
 			"quantity":     float64(10),
 			"sold":         float64(0),
-			"revenue":      float64(0),
+			"revenue":      map[string]interface{}{"amount": float64(0), "currency": "USD"},
 			"user_id":      tests.AdminID,
+			"categories":   []interface{}{"9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"},
+			"tags":         []interface{}{"garage"},
+			"images":       []interface{}{},
 		}
 
 		// Updated product should match the one we created.
@@ -253,4 +923,48 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 			t.Fatalf("retrieving: expected status code %v, got %v", http.StatusNotFound, resp.Code)
 		}
 	}
+
+	{ // TRASH
+		req := httptest.NewRequest("GET", "/v1/products/trash", nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusOK != resp.Code {
+			t.Fatalf("listing trash: expected status code %v, got %v", http.StatusOK, resp.Code)
+		}
+
+		var trash []map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&trash); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		if len(trash) != 1 || trash[0]["id"] != created["id"] {
+			t.Fatalf("expected deleted product in trash, got %v", trash)
+		}
+	}
+
+	{ // RESTORE
+		url := fmt.Sprintf("/v1/products/%s/restore", created["id"])
+		req := httptest.NewRequest("POST", url, nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusNoContent != resp.Code {
+			t.Fatalf("restoring: expected status code %v, got %v", http.StatusNoContent, resp.Code)
+		}
+
+		// Retrieve the restored record to be sure it worked.
+		req = httptest.NewRequest("GET", fmt.Sprintf("/v1/products/%s", created["id"]), nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp = httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusOK != resp.Code {
+			t.Fatalf("retrieving: expected status code %v, got %v", http.StatusOK, resp.Code)
+		}
+	}
 }
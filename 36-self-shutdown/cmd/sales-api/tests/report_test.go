@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/a2go/garagesale/cmd/sales-api/internal/handlers"
+	"github.com/a2go/garagesale/internal/tests"
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestReports runs a series of tests to exercise sales reports from the API
+// level against the seeded sales.
+func TestReports(t *testing.T) {
+	test := tests.New(t)
+	defer test.Teardown()
+
+	shutdown := make(chan os.Signal, 1)
+	rt := ReportTests{
+		app:        handlers.API(shutdown, test.DB, test.Log, test.Authenticator, handlers.Config{MaxBodyBytes: 1 << 20}),
+		adminToken: test.Token("admin@example.com", "gophers"),
+		userToken:  test.Token("user@example.com", "gophers"),
+	}
+
+	t.Run("RevenueCSV", rt.RevenueCSV)
+	t.Run("UnitsOwnProducts", rt.UnitsOwnProducts)
+	t.Run("InvalidTimezone", rt.InvalidTimezone)
+}
+
+// ReportTests holds methods for each report subtest. This type allows
+// passing dependencies for tests while still providing a convenient syntax
+// when subtests are registered.
+type ReportTests struct {
+	app        http.Handler
+	adminToken string
+	userToken  string
+}
+
+// RevenueCSV totals the seeded sales by day in Paris as CSV.
+func (rt *ReportTests) RevenueCSV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/reports/revenue?interval=day&tz=Europe/Paris", nil)
+	req.Header.Set("Authorization", "Bearer "+rt.adminToken)
+	req.Header.Set("Accept", "text/csv")
+	resp := httptest.NewRecorder()
+
+	rt.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+
+	want := [][]string{
+		{"start", "end", "currency", "value"},
+		{"2019-01-01T00:00:00+01:00", "2019-01-02T00:00:00+01:00", "USD", "575"},
+	}
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Fatalf("Response did not match expected. Diff:\n%s", diff)
+	}
+}
+
+// UnitsOwnProducts ensures regular users only see sales of their own
+// products, and are denied reports on anyone else's.
+func (rt *ReportTests) UnitsOwnProducts(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/reports/units", nil)
+	req.Header.Set("Authorization", "Bearer "+rt.userToken)
+	resp := httptest.NewRecorder()
+
+	rt.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var list []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("expected no buckets for the user's products, got %v", list)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/reports/units?user_id=5cf37266-3473-4006-984f-9325122678b7", nil)
+	req.Header.Set("Authorization", "Bearer "+rt.userToken)
+	resp = httptest.NewRecorder()
+
+	rt.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusForbidden, resp.Code)
+	}
+}
+
+// InvalidTimezone ensures a time zone which is not in the IANA database is
+// rejected.
+func (rt *ReportTests) InvalidTimezone(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/reports/revenue?tz=Mars/Olympus_Mons", nil)
+	req.Header.Set("Authorization", "Bearer "+rt.adminToken)
+	resp := httptest.NewRecorder()
+
+	rt.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusBadRequest, resp.Code)
+	}
+
+	var got map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if got["code"] != "invalid_timezone" {
+		t.Fatalf("expected code invalid_timezone, got %v", got["code"])
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/a2go/garagesale/cmd/sales-api/internal/handlers"
+	"github.com/a2go/garagesale/internal/platform/ratelimit"
 	"github.com/a2go/garagesale/internal/tests"
 )
 
@@ -17,12 +19,17 @@ func TestUsers(t *testing.T) {
 	defer test.Teardown()
 
 	shutdown := make(chan os.Signal, 1)
-	ut := UserTests{app: handlers.API(shutdown, test.DB, test.Log, test.Authenticator)}
+	cfg := handlers.Config{
+		MaxBodyBytes: 1 << 20,
+		TokenLimit:   ratelimit.Limit{Requests: 5, Per: time.Hour},
+	}
+	ut := UserTests{app: handlers.API(shutdown, test.DB, test.Log, test.Authenticator, cfg)}
 
 	t.Run("TokenRequireAuth", ut.TokenRequireAuth)
 	t.Run("TokenDenyUnknown", ut.TokenDenyUnknown)
 	t.Run("TokenDenyBadPassword", ut.TokenDenyBadPassword)
 	t.Run("TokenSuccess", ut.TokenSuccess)
+	t.Run("TokenRateLimited", ut.TokenRateLimited)
 }
 
 // UserTests holds methods for each user subtest. This type allows passing
@@ -56,6 +63,15 @@ func (ut *UserTests) TokenDenyUnknown(t *testing.T) {
 	if resp.Code != http.StatusUnauthorized {
 		t.Fatalf("getting: expected status code %v, got %v", http.StatusUnauthorized, resp.Code)
 	}
+
+	var got map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+
+	if got["code"] != "authentication_failed" {
+		t.Fatalf("expected error code %q, got %v", "authentication_failed", got["code"])
+	}
 }
 
 // TokenDenyBadPassword ensures that a known user with a bad password is not authenticated.
@@ -98,3 +114,30 @@ func (ut *UserTests) TokenSuccess(t *testing.T) {
 		t.Fatal("token was not in response")
 	}
 }
+
+// TokenRateLimited ensures a client which keeps asking for tokens is turned
+// away once its allowance is spent. Earlier subtests used part of it.
+func (ut *UserTests) TokenRateLimited(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/v1/users/token", nil)
+		resp := httptest.NewRecorder()
+
+		req.SetBasicAuth("admin@example.com", "gophers")
+
+		ut.app.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusTooManyRequests {
+			continue
+		}
+
+		if got := resp.Header().Get("RateLimit-Limit"); got != "5" {
+			t.Fatalf("expected RateLimit-Limit %q, got %q", "5", got)
+		}
+		if got := resp.Header().Get("Retry-After"); got == "" || got == "0" {
+			t.Fatalf("expected a Retry-After delay, got %q", got)
+		}
+		return
+	}
+
+	t.Fatalf("getting: expected status code %v after 5 requests", http.StatusTooManyRequests)
+}
@@ -0,0 +1,202 @@
+package category
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a specific Category is requested but does not
+	// exist.
+	ErrNotFound = errors.New("category not found")
+
+	// ErrInvalidParent is used when a parent Category does not exist or would
+	// make the tree circular.
+	ErrInvalidParent = errors.New("parent must be an existing category outside of this one")
+
+	// ErrHasChildren is used when deleting a Category which still has
+	// subcategories.
+	ErrHasChildren = errors.New("category has subcategories")
+)
+
+func init() {
+
+	// Tell the web layer how to respond when these errors reach a handler.
+	web.RegisterError(ErrNotFound, http.StatusNotFound, "category_not_found")
+	web.RegisterError(ErrInvalidParent, http.StatusBadRequest, "invalid_parent")
+	web.RegisterError(ErrHasChildren, http.StatusConflict, "category_not_empty")
+}
+
+// List gets all Categories from the database.
+func List(ctx context.Context, db *sqlx.DB) ([]Category, error) {
+	ctx, span := trace.StartSpan(ctx, "category.List")
+	defer span.End()
+
+	categories := []Category{}
+	const q = `SELECT * FROM categories ORDER BY name, category_id`
+	if err := db.SelectContext(ctx, &categories, q); err != nil {
+		return nil, errors.Wrap(err, "selecting categories")
+	}
+
+	return categories, nil
+}
+
+// Get finds the Category identified by a given ID.
+func Get(ctx context.Context, db *sqlx.DB, id string) (*Category, error) {
+	ctx, span := trace.StartSpan(ctx, "category.Get")
+	defer span.End()
+
+	var c Category
+	const q = `SELECT * FROM categories WHERE category_id = $1`
+	if err := db.GetContext(ctx, &c, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "selecting single category")
+	}
+
+	return &c, nil
+}
+
+// Create adds a Category to the database. It returns the created Category
+// with fields like ID and DateCreated populated.
+func Create(ctx context.Context, db *sqlx.DB, nc NewCategory, now time.Time) (*Category, error) {
+	ctx, span := trace.StartSpan(ctx, "category.Create")
+	defer span.End()
+
+	c := Category{
+		ID:          uuid.New().String(),
+		ParentID:    nc.ParentID,
+		Name:        nc.Name,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	if c.ParentID != nil {
+		if err := checkParent(ctx, db, c.ID, *c.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	const q = `INSERT INTO categories
+		(category_id, parent_id, name, date_created, date_updated)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := db.ExecContext(ctx, q,
+		c.ID, c.ParentID, c.Name,
+		c.DateCreated, c.DateUpdated,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting category")
+	}
+
+	return &c, nil
+}
+
+// Update modifies a Category. Changing its parent moves it, along with its
+// subcategories, to another place in the tree.
+func Update(ctx context.Context, db *sqlx.DB, id string, update UpdateCategory, now time.Time) error {
+	ctx, span := trace.StartSpan(ctx, "category.Update")
+	defer span.End()
+
+	c, err := Get(ctx, db, id)
+	if err != nil {
+		return err
+	}
+
+	if update.Name != nil {
+		c.Name = *update.Name
+	}
+	if update.ParentID != nil {
+		c.ParentID = update.ParentID
+		if *update.ParentID == "" {
+			c.ParentID = nil
+		}
+	}
+	c.DateUpdated = now.UTC()
+
+	if c.ParentID != nil {
+		if err := checkParent(ctx, db, c.ID, *c.ParentID); err != nil {
+			return err
+		}
+	}
+
+	const q = `UPDATE categories SET
+		"parent_id" = $2,
+		"name" = $3,
+		"date_updated" = $4
+		WHERE category_id = $1`
+	_, err = db.ExecContext(ctx, q, id, c.ParentID, c.Name, c.DateUpdated)
+	if err != nil {
+		return errors.Wrap(err, "updating category")
+	}
+
+	return nil
+}
+
+// Delete removes the Category identified by a given ID. Products filed under
+// it are kept. A Category with subcategories cannot be deleted.
+func Delete(ctx context.Context, db *sqlx.DB, id string) error {
+	ctx, span := trace.StartSpan(ctx, "category.Delete")
+	defer span.End()
+
+	var children bool
+	const childQ = `SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)`
+	if err := db.GetContext(ctx, &children, childQ, id); err != nil {
+		return errors.Wrapf(err, "checking subcategories of %s", id)
+	}
+	if children {
+		return ErrHasChildren
+	}
+
+	const q = `DELETE FROM categories WHERE category_id = $1`
+	if _, err := db.ExecContext(ctx, q, id); err != nil {
+		return errors.Wrapf(err, "deleting category %s", id)
+	}
+
+	return nil
+}
+
+// checkParent ensures parentID can be the parent of the Category id. It must
+// exist and must not be the Category itself or one of its descendants.
+func checkParent(ctx context.Context, db *sqlx.DB, id, parentID string) error {
+	if _, err := uuid.Parse(parentID); err != nil {
+		return ErrInvalidParent
+	}
+
+	// Walk up from the parent to the top of the tree. Finding id on the way
+	// means the move would create a cycle.
+	const q = `WITH RECURSIVE ancestors AS (
+			SELECT category_id, parent_id FROM categories WHERE category_id = $1
+			UNION
+			SELECT c.category_id, c.parent_id
+			FROM categories AS c
+			JOIN ancestors AS a ON c.category_id = a.parent_id
+		)
+		SELECT category_id FROM ancestors`
+
+	var ancestors []string
+	if err := db.SelectContext(ctx, &ancestors, q, parentID); err != nil {
+		return errors.Wrap(err, "selecting parent categories")
+	}
+
+	if len(ancestors) == 0 {
+		return ErrInvalidParent
+	}
+	for _, a := range ancestors {
+		if a == id {
+			return ErrInvalidParent
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package category_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a2go/garagesale/internal/category"
+	"github.com/a2go/garagesale/internal/tests"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestCategories(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	games, err := category.Create(ctx, db, category.NewCategory{Name: "Games"}, now)
+	if err != nil {
+		t.Fatalf("creating category: %s", err)
+	}
+
+	boards, err := category.Create(ctx, db, category.NewCategory{Name: "Board Games", ParentID: &games.ID}, now)
+	if err != nil {
+		t.Fatalf("creating subcategory: %s", err)
+	}
+
+	saved, err := category.Get(ctx, db, boards.ID)
+	if err != nil {
+		t.Fatalf("getting category: %s", err)
+	}
+	if diff := cmp.Diff(boards, saved); diff != "" {
+		t.Fatalf("fetched != created:\n%s", diff)
+	}
+
+	missing := "2bd3b2e5-c4a3-4a38-9e79-3f7fe8d0d0a5"
+	if _, err := category.Create(ctx, db, category.NewCategory{Name: "Lost", ParentID: &missing}, now); errors.Cause(err) != category.ErrInvalidParent {
+		t.Fatalf("expected %v for a missing parent, got %v", category.ErrInvalidParent, err)
+	}
+
+	// Moving a category under its own subcategory would make a cycle.
+	cycle := category.UpdateCategory{ParentID: &boards.ID}
+	if err := category.Update(ctx, db, games.ID, cycle, now); errors.Cause(err) != category.ErrInvalidParent {
+		t.Fatalf("expected %v for a cycle, got %v", category.ErrInvalidParent, err)
+	}
+
+	if err := category.Delete(ctx, db, games.ID); errors.Cause(err) != category.ErrHasChildren {
+		t.Fatalf("expected %v deleting a parent, got %v", category.ErrHasChildren, err)
+	}
+
+	// Move the subcategory to the top so its old parent can be deleted.
+	top := ""
+	if err := category.Update(ctx, db, boards.ID, category.UpdateCategory{ParentID: &top}, now); err != nil {
+		t.Fatalf("moving category: %s", err)
+	}
+	if err := category.Delete(ctx, db, games.ID); err != nil {
+		t.Fatalf("deleting category: %s", err)
+	}
+
+	list, err := category.List(ctx, db)
+	if err != nil {
+		t.Fatalf("listing categories: %s", err)
+	}
+	if len(list) != 1 || list[0].ID != boards.ID || list[0].ParentID != nil {
+		t.Fatalf("expected only the moved category at the top, got %+v", list)
+	}
+}
@@ -0,0 +1,3 @@
+// Package category implements all business logic regarding the tree of
+// categories products are filed under.
+package category
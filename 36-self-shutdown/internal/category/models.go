@@ -0,0 +1,30 @@
+package category
+
+import (
+	"time"
+)
+
+// Category groups related Products. Categories form a tree where a Category
+// without a ParentID is at the top.
+type Category struct {
+	ID          string    `db:"category_id" json:"id"`
+	ParentID    *string   `db:"parent_id" json:"parent_id"`
+	Name        string    `db:"name" json:"name"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+}
+
+// NewCategory is what we require from clients when adding a Category.
+type NewCategory struct {
+	Name     string  `json:"name" validate:"required"`
+	ParentID *string `json:"parent_id" validate:"omitempty,uuid"`
+}
+
+// UpdateCategory defines what information may be provided to modify an
+// existing Category. All fields are optional so clients can send just the
+// fields they want changed. An empty ParentID moves the Category to the top
+// of the tree.
+type UpdateCategory struct {
+	Name     *string `json:"name" validate:"omitempty,min=1"`
+	ParentID *string `json:"parent_id" validate:"omitempty,uuid_or_empty"`
+}
@@ -0,0 +1,24 @@
+package category
+
+import (
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+)
+
+// Actions which can be performed on Categories.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Policy decides who may change Categories. Any user can read them but only
+// admins can change the tree.
+var Policy = authz.Policy{
+	Kind: "category",
+	Rules: map[string]authz.Rule{
+		ActionCreate: authz.Role(auth.RoleAdmin),
+		ActionUpdate: authz.Role(auth.RoleAdmin),
+		ActionDelete: authz.Role(auth.RoleAdmin),
+	},
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
 	"github.com/a2go/garagesale/internal/platform/web"
 	"go.opencensus.io/trace"
 )
@@ -85,3 +86,34 @@ func HasRole(roles ...string) web.Middleware {
 
 	return f
 }
+
+// Authorize checks that the authenticated user may perform action according
+// to policy. No particular resource is loaded at this point, so only rules
+// which do not depend on one, like authz.Role, can allow the request. Rules
+// about a specific resource are checked by the domain code which loads it.
+func Authorize(policy authz.Policy, action string) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(after web.Handler) web.Handler {
+
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := trace.StartSpan(ctx, "internal.mid.Authorize")
+			defer span.End()
+
+			claims, ok := ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				return errors.New("claims missing from context: Authorize called without/before Authenticate")
+			}
+
+			if err := policy.Check(claims, action, authz.Resource{}); err != nil {
+				return err
+			}
+
+			return after(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return f
+}
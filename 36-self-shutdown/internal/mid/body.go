@@ -0,0 +1,34 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/a2go/garagesale/internal/platform/web"
+	"go.opencensus.io/trace"
+)
+
+// BodyLimit restricts request bodies to n bytes. Handlers decoding a larger
+// body get an error which is answered with 413 Request Entity Too Large. A
+// limit of zero or less leaves bodies unrestricted.
+func BodyLimit(n int64) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(after web.Handler) web.Handler {
+
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := trace.StartSpan(ctx, "internal.mid.BodyLimit")
+			defer span.End()
+
+			if n > 0 {
+				web.LimitBody(r, n)
+			}
+
+			return after(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return f
+}
@@ -0,0 +1,283 @@
+package mid
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/a2go/garagesale/internal/platform/web"
+	"go.opencensus.io/trace"
+)
+
+// Compress compresses response bodies with gzip or deflate when the client
+// accepts it. Bodies smaller than minSize bytes, responses without a body
+// such as 204 and 304, and content which is not compressible are sent as is.
+//
+// Compress must come before Errors in the middleware list so error responses
+// are compressed too. It does not change the status recorded in web.Values.
+func Compress(minSize int) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(after web.Handler) web.Handler {
+
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := trace.StartSpan(ctx, "internal.mid.Compress")
+			defer span.End()
+
+			// Responses differ by accepted encoding so caches must key on it.
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				return after(ctx, w, r)
+			}
+
+			cw := compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minSize:        minSize,
+			}
+
+			err := after(ctx, &cw, r)
+
+			// Send whatever is still buffered even if the handler failed.
+			if cerr := cw.finish(); cerr != nil && err == nil {
+				err = cerr
+			}
+
+			return err
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring the higher quality and then gzip. It returns "" if the client
+// accepts neither.
+func acceptedEncoding(header string) string {
+	var gzipQ, deflateQ, anyQ float64 = -1, -1, -1
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+
+		switch name {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "deflate":
+			deflateQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+
+	// Encodings which are not named explicitly get the quality of "*".
+	if gzipQ < 0 {
+		gzipQ = anyQ
+	}
+	if deflateQ < 0 {
+		deflateQ = anyQ
+	}
+
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressible reports whether a Content-Type is worth compressing. Images,
+// archives and other binary formats are usually compressed already.
+func compressible(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+
+	switch {
+	case ct == "":
+		return true
+	case strings.HasPrefix(ct, "text/"):
+		return true
+	case strings.HasSuffix(ct, "+json"), strings.HasSuffix(ct, "+xml"):
+		return true
+	}
+
+	switch ct {
+	case "application/json", "application/x-ndjson", "application/xml",
+		"application/javascript", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// Pools of compressors so they are not allocated for every response.
+var (
+	gzipPool = sync.Pool{
+		New: func() interface{} { return gzip.NewWriter(nil) },
+	}
+	flatePool = sync.Pool{
+		New: func() interface{} {
+			w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+			return w
+		},
+	}
+)
+
+// compressor is implemented by both *gzip.Writer and *flate.Writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// body is large enough to compress. It then either compresses everything or
+// passes everything through unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	buf         []byte
+	comp        compressor
+	passthrough bool
+}
+
+// WriteHeader records the status code. Responses which cannot have a body
+// are passed straight through.
+func (c *compressWriter) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+
+	noBody := status < http.StatusOK ||
+		status == http.StatusNoContent ||
+		status == http.StatusNotModified
+	if noBody || c.Header().Get("Content-Encoding") != "" {
+		c.passthrough = true
+		c.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write buffers p until minSize bytes are available and then compresses.
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+
+	switch {
+	case c.passthrough:
+		return c.ResponseWriter.Write(p)
+	case c.comp != nil:
+		return c.comp.Write(p)
+	}
+
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.minSize {
+		if err := c.start(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush sends what has been written so far. A flushed response is being
+// streamed so it is compressed even if it is still small.
+func (c *compressWriter) Flush() {
+	if c.status != 0 && !c.passthrough && c.comp == nil {
+		if err := c.start(); err != nil {
+			return
+		}
+	}
+	if c.comp != nil {
+		c.comp.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// start decides how to send the body, writes the header and any buffered
+// bytes.
+func (c *compressWriter) start() error {
+	if !compressible(c.Header().Get("Content-Type")) {
+		return c.passThrough()
+	}
+
+	switch c.encoding {
+	case "gzip":
+		c.comp = gzipPool.Get().(*gzip.Writer)
+	default:
+		c.comp = flatePool.Get().(*flate.Writer)
+	}
+	c.comp.Reset(c.ResponseWriter)
+
+	c.Header().Set("Content-Encoding", c.encoding)
+	c.Header().Del("Content-Length")
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	_, err := c.comp.Write(buf)
+	return err
+}
+
+// passThrough sends the header and buffered bytes uncompressed.
+func (c *compressWriter) passThrough() error {
+	c.passthrough = true
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish ends the response once the handler has returned.
+func (c *compressWriter) finish() error {
+	switch {
+	case c.passthrough:
+		return nil
+
+	case c.comp != nil:
+		err := c.comp.Close()
+		switch comp := c.comp.(type) {
+		case *gzip.Writer:
+			gzipPool.Put(comp)
+		case *flate.Writer:
+			flatePool.Put(comp)
+		}
+		c.comp = nil
+		return err
+
+	case c.status != 0:
+
+		// The body never reached minSize so send it as is.
+		return c.passThrough()
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/web"
+	"go.opencensus.io/trace"
+)
+
+// CORSConfig controls which cross-origin requests browsers are allowed to
+// make. Empty AllowedMethods and AllowedHeaders use sensible defaults. An
+// AllowedOrigins entry of "*" allows any origin, so it cannot be combined
+// with AllowCredentials.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// These are used when the CORSConfig does not list methods or headers.
+var (
+	defaultCORSMethods = []string{
+		http.MethodGet, http.MethodPost, http.MethodPut,
+		http.MethodDelete, http.MethodHead,
+	}
+	defaultCORSHeaders = []string{
+		"Accept", "Accept-Language", "Authorization", "Content-Type",
+	}
+)
+
+// Validate reports whether cfg is safe to use. Allowing credentials from any
+// origin would let every site make requests with a user's cookies.
+func (cfg CORSConfig) Validate() error {
+	if cfg.AllowCredentials && contains(cfg.AllowedOrigins, "*") {
+		return errors.New("CORS credentials cannot be allowed for every origin")
+	}
+	return nil
+}
+
+// CORS adds Cross-Origin Resource Sharing headers for allowed origins. It
+// answers preflight OPTIONS requests itself, so it should be given to
+// web.NewApp where it also runs for routes which do not handle OPTIONS. It
+// panics if cfg does not pass Validate.
+func CORS(cfg CORSConfig) web.Middleware {
+	if err := cfg.Validate(); err != nil {
+		panic("mid: " + err.Error())
+	}
+
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge / time.Second))
+
+	// This is the actual middleware function to be executed.
+	f := func(after web.Handler) web.Handler {
+
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := trace.StartSpan(ctx, "internal.mid.CORS")
+			defer span.End()
+
+			// Responses differ by origin so caches must key on it.
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			if origin == "" || !contains(cfg.AllowedOrigins, origin) {
+				return after(ctx, w, r)
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// A preflight is an OPTIONS request asking permission for the
+			// real request. It is answered here and never reaches a handler.
+			reqMethod := r.Header.Get("Access-Control-Request-Method")
+			if r.Method != http.MethodOptions || reqMethod == "" {
+				if exposeHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+				return after(ctx, w, r)
+			}
+
+			if contains(methods, reqMethod) {
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+
+				// A "*" entry allows whatever headers the browser asks for.
+				allow := allowHeaders
+				if contains(headers, "*") {
+					allow = r.Header.Get("Access-Control-Request-Headers")
+				}
+				if allow != "" {
+					w.Header().Set("Access-Control-Allow-Headers", allow)
+				}
+
+				if cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", maxAge)
+				}
+			}
+
+			return web.Respond(ctx, w, nil, http.StatusNoContent)
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// contains reports whether list holds value or "*". Values are compared
+// without regard to case.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
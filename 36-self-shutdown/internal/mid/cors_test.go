@@ -0,0 +1,32 @@
+package mid_test
+
+import (
+	"testing"
+
+	"github.com/a2go/garagesale/internal/mid"
+)
+
+func TestCORSConfig(t *testing.T) {
+	tests := []struct {
+		cfg   mid.CORSConfig
+		valid bool
+	}{
+		{mid.CORSConfig{AllowedOrigins: []string{"*"}}, true},
+		{mid.CORSConfig{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true}, true},
+		{mid.CORSConfig{AllowedOrigins: []string{"https://example.com", "*"}, AllowCredentials: true}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.valid {
+			t.Fatalf("%+v: expected valid to be %v, got error %v", tt.cfg, tt.valid, err)
+		}
+	}
+
+	// Building the middleware from a config which is not valid panics.
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic allowing credentials for every origin")
+		}
+	}()
+	mid.CORS(mid.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+}
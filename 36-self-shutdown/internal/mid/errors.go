@@ -11,6 +11,7 @@ import (
 
 // Errors handles errors coming out of the call chain. It detects normal
 // application errors which are used to respond to the client in a uniform way.
+// Clients which accept application/problem+json get RFC 7807 problem details.
 // Unexpected errors (status >= 500) are logged.
 func Errors(log *log.Logger) web.Middleware {
 
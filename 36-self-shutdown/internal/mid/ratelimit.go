@@ -0,0 +1,90 @@
+package mid
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/ratelimit"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// ErrRateLimited is returned when a client has used up its allowance for a
+// route.
+var ErrRateLimited = web.NewRequestError(
+	errors.New("rate limit exceeded"),
+	http.StatusTooManyRequests,
+)
+
+// RateLimit restricts how often a client may call the routes it wraps.
+// Authenticated clients are identified by their claims subject so RateLimit
+// must run after Authenticate on those routes. Other clients are identified
+// by IP address. The scope keeps the buckets for different routes apart so
+// each route can have its own limit. A disabled limit allows every request.
+// It panics if l does not pass Validate.
+func RateLimit(store ratelimit.Store, scope string, l ratelimit.Limit) web.Middleware {
+	if err := l.Validate(); err != nil {
+		panic("mid: " + err.Error())
+	}
+
+	limit := strconv.Itoa(l.Requests)
+
+	// This is the actual middleware function to be executed.
+	f := func(after web.Handler) web.Handler {
+
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := trace.StartSpan(ctx, "internal.mid.RateLimit")
+			defer span.End()
+
+			if !l.Enabled() {
+				return after(ctx, w, r)
+			}
+
+			res, err := store.Take(ctx, scope+":"+client(ctx, r), l)
+			if err != nil {
+				return errors.Wrap(err, "checking rate limit")
+			}
+
+			w.Header().Set("RateLimit-Limit", limit)
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", seconds(res.RetryAfter))
+				return ErrRateLimited
+			}
+
+			return after(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// client identifies who made the request. The address of the connection is
+// used rather than forwarding headers, which clients can forge.
+func client(ctx context.Context, r *http.Request) string {
+	if claims, ok := ctx.Value(auth.Key).(auth.Claims); ok && claims.Subject != "" {
+		return "user:" + claims.Subject
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// seconds formats d as a whole number of seconds, rounding up so clients
+// never retry too early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
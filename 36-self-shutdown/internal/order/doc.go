@@ -0,0 +1,3 @@
+// Package order implements all business logic regarding orders, where a
+// buyer takes several products at once.
+package order
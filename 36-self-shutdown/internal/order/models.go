@@ -0,0 +1,50 @@
+package order
+
+import (
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/money"
+)
+
+// Order is a set of Products bought together. Each Line is recorded as a
+// product.Sale. Total is what the Lines cost when the Order was made and Paid
+// is what the buyer actually paid after haggling, which is split across the
+// Lines. Every amount is in the one currency the Products are sold in.
+// UserID is the subject of the claims which recorded the Order.
+type Order struct {
+	ID          string      `db:"order_id" json:"id"`
+	UserID      string      `db:"user_id" json:"user_id"`
+	Total       money.Money `db:"total" json:"total"`
+	Paid        money.Money `db:"paid" json:"paid"`
+	DateCreated time.Time   `db:"date_created" json:"date_created"`
+	Lines       []Line      `db:"-" json:"lines"`
+}
+
+// Line is one Product in an Order, numbered from 1. Name and Cost are those
+// of the Product when the Order was made. Total is Cost times Quantity and
+// Paid is the share of what was paid for the Order, which is also what the
+// Sale records.
+type Line struct {
+	Line      int         `db:"line" json:"line"`
+	SaleID    string      `db:"sale_id" json:"sale_id"`
+	ProductID string      `db:"product_id" json:"product_id"`
+	Name      string      `db:"name" json:"name"`
+	Cost      money.Money `db:"cost" json:"cost"`
+	Quantity  int         `db:"quantity" json:"quantity"`
+	Total     money.Money `db:"total" json:"total"`
+	Paid      money.Money `db:"paid" json:"paid"`
+}
+
+// NewOrder is what we require from clients when recording an Order. When
+// Paid is not given the buyer paid the full total.
+type NewOrder struct {
+	Lines []NewLine    `json:"lines" validate:"required,min=1,max=100,dive"`
+	Paid  *money.Money `json:"paid"`
+}
+
+// NewLine is one Product in a NewOrder. Each Product may only be in one
+// line.
+type NewLine struct {
+	ProductID string `json:"product_id" validate:"required,uuid"`
+	Quantity  int    `json:"quantity" validate:"gte=1"`
+}
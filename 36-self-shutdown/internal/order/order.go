@@ -0,0 +1,256 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/a2go/garagesale/internal/product"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a specific Order is requested but does not
+	// exist.
+	ErrNotFound = errors.New("order not found")
+
+	// ErrInvalidID is used when an Order or Product ID is malformed.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrNoLines is used when creating an Order without any Products.
+	ErrNoLines = errors.New("order must have at least one line")
+
+	// ErrDuplicateProduct is used when a Product is in more than one line of
+	// an Order.
+	ErrDuplicateProduct = errors.New("each product may only be in one line of an order")
+
+	// ErrInvalidPaid is used when the amount paid for an Order is negative,
+	// more than its total or in another currency.
+	ErrInvalidPaid = errors.New("paid must be between 0 and the order total, in the same currency")
+
+	// ErrMixedCurrencies is used when the Products in an Order are not all
+	// sold in the same currency.
+	ErrMixedCurrencies = errors.New("every product in an order must be sold in the same currency")
+)
+
+func init() {
+
+	// Tell the web layer how to respond when these errors reach a handler.
+	web.RegisterError(ErrNotFound, http.StatusNotFound, "order_not_found")
+	web.RegisterError(ErrInvalidID, http.StatusBadRequest, "invalid_id")
+	web.RegisterError(ErrNoLines, http.StatusBadRequest, "empty_order")
+	web.RegisterError(ErrDuplicateProduct, http.StatusBadRequest, "duplicate_product")
+	web.RegisterError(ErrInvalidPaid, http.StatusBadRequest, "invalid_paid")
+	web.RegisterError(ErrMixedCurrencies, http.StatusBadRequest, "mixed_currencies")
+}
+
+// Create records an Order on behalf of user, who must be allowed to sell
+// every Product in it by product.Policy. Each line is recorded as a Sale in
+// one transaction, so either the whole Order is recorded or none of it is.
+// The Products are locked while their stock is checked, which fails the
+// same way as product.AddSale. Every Product must be sold in the same
+// currency, which is the currency of the Order.
+func Create(ctx context.Context, db *sqlx.DB, user auth.Claims, no NewOrder, now time.Time) (*Order, error) {
+	ctx, span := trace.StartSpan(ctx, "order.Create")
+	defer span.End()
+
+	if len(no.Lines) == 0 {
+		return nil, ErrNoLines
+	}
+
+	ids := make([]string, len(no.Lines))
+	seen := make(map[string]bool, len(no.Lines))
+	for i, nl := range no.Lines {
+		id, err := uuid.Parse(nl.ProductID)
+		if err != nil {
+			return nil, ErrInvalidID
+		}
+		ids[i] = id.String()
+		if seen[ids[i]] {
+			return nil, ErrDuplicateProduct
+		}
+		seen[ids[i]] = true
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	// Lock every Product in the same order so concurrent Orders for the same
+	// Products cannot deadlock. The cost is read under the lock so it cannot
+	// change before the Order is recorded.
+	var locked []Line
+	const lockQ = `SELECT product_id, name, cost FROM products
+		WHERE product_id = ANY($1) AND deleted_at IS NULL
+		ORDER BY product_id
+		FOR UPDATE`
+	if err := tx.SelectContext(ctx, &locked, lockQ, pq.Array(ids)); err != nil {
+		return nil, errors.Wrap(err, "locking products")
+	}
+
+	products := make(map[string]Line, len(locked))
+	for _, p := range locked {
+		products[p.ProductID] = p
+	}
+
+	o := Order{
+		ID:          uuid.New().String(),
+		UserID:      user.Subject,
+		DateCreated: now.UTC(),
+		Lines:       make([]Line, len(no.Lines)),
+	}
+
+	totals := make([]int, len(no.Lines))
+	for i, nl := range no.Lines {
+		p, ok := products[ids[i]]
+		if !ok {
+			return nil, errors.Wrapf(product.ErrNotFound, "line %d", i+1)
+		}
+
+		currency := p.Cost.Currency
+		if i > 0 && currency != o.Total.Currency {
+			return nil, ErrMixedCurrencies
+		}
+
+		o.Lines[i] = Line{
+			Line:      i + 1,
+			ProductID: p.ProductID,
+			Name:      p.Name,
+			Cost:      p.Cost,
+			Quantity:  nl.Quantity,
+			Total:     money.Money{Amount: p.Cost.Amount * nl.Quantity, Currency: currency},
+		}
+		totals[i] = o.Lines[i].Total.Amount
+		o.Total = money.Money{Amount: o.Total.Amount + totals[i], Currency: currency}
+	}
+
+	o.Paid = o.Total
+	if no.Paid != nil {
+		o.Paid = *no.Paid
+	}
+	if o.Paid.Currency != o.Total.Currency || o.Paid.Amount < 0 || o.Paid.Amount > o.Total.Amount {
+		return nil, ErrInvalidPaid
+	}
+
+	const orderQ = `INSERT INTO orders
+		(order_id, user_id, total, paid, date_created)
+		VALUES ($1, $2, $3, $4, $5)`
+	if _, err := tx.ExecContext(ctx, orderQ, o.ID, o.UserID, o.Total, o.Paid, o.DateCreated); err != nil {
+		return nil, errors.Wrap(err, "inserting order")
+	}
+
+	const lineQ = `INSERT INTO order_lines
+		(order_id, line, sale_id, name, cost)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	shares := split(o.Paid.Amount, totals)
+	for i := range o.Lines {
+		l := &o.Lines[i]
+		l.Paid = money.Money{Amount: shares[i], Currency: o.Paid.Currency}
+
+		ns := product.NewSale{Quantity: l.Quantity, Paid: l.Paid}
+		s, err := product.Sell(ctx, tx, user, ns, l.ProductID, o.DateCreated)
+		if err != nil {
+			return nil, errors.Wrapf(err, "selling line %d", l.Line)
+		}
+		l.SaleID = s.ID
+
+		if _, err := tx.ExecContext(ctx, lineQ, o.ID, l.Line, l.SaleID, l.Name, l.Cost); err != nil {
+			return nil, errors.Wrapf(err, "inserting line %d", l.Line)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing order")
+	}
+
+	return &o, nil
+}
+
+// Get finds the Order identified by a given ID on behalf of user, who must
+// be allowed to view it by the Policy.
+func Get(ctx context.Context, db *sqlx.DB, user auth.Claims, id string) (*Order, error) {
+	ctx, span := trace.StartSpan(ctx, "order.Get")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var o Order
+	const q = `SELECT * FROM orders WHERE order_id = $1`
+	if err := db.GetContext(ctx, &o, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "selecting single order")
+	}
+
+	if err := Policy.Check(user, ActionView, o.resource()); err != nil {
+		return nil, err
+	}
+
+	o.Lines = []Line{}
+	const linesQ = `SELECT ol.line, ol.sale_id, s.product_id, ol.name, ol.cost,
+			s.quantity,
+			ROW((ol.cost).amount * s.quantity, (ol.cost).currency)::monetary AS total,
+			s.paid
+		FROM order_lines AS ol
+		JOIN sales AS s ON s.sale_id = ol.sale_id
+		WHERE ol.order_id = $1
+		ORDER BY ol.line`
+	if err := db.SelectContext(ctx, &o.Lines, linesQ, id); err != nil {
+		return nil, errors.Wrap(err, "selecting order lines")
+	}
+
+	return &o, nil
+}
+
+// split divides paid between lines in proportion to their totals, which
+// must add up to at least paid. Each share is rounded down and what is left
+// over goes one at a time to the lines which lost the most by rounding,
+// earliest first, so the shares always add up to paid.
+func split(paid int, totals []int) []int {
+	shares := make([]int, len(totals))
+
+	var sum int
+	for _, t := range totals {
+		sum += t
+	}
+	if sum == 0 {
+		return shares
+	}
+
+	left := paid
+	remainders := make([]int, len(totals))
+	for i, t := range totals {
+		shares[i] = paid * t / sum
+		remainders[i] = paid * t % sum
+		left -= shares[i]
+	}
+
+	order := make([]int, len(totals))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; i < left; i++ {
+		shares[order[i]]++
+	}
+
+	return shares
+}
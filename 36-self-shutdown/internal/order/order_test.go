@@ -0,0 +1,176 @@
+package order_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a2go/garagesale/internal/order"
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/a2go/garagesale/internal/product"
+	"github.com/a2go/garagesale/internal/tests"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestOrders(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	owner := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, now, time.Hour)
+	other := auth.NewClaims(tests.AdminID, []string{auth.RoleUser}, now, time.Hour)
+
+	puzzles, err := product.Create(ctx, db, owner, product.NewProduct{Name: "Puzzles", Cost: tests.USD(25), Quantity: 6}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	toys, err := product.Create(ctx, db, owner, product.NewProduct{Name: "Toys", Cost: tests.USD(40), Quantity: 3}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	books, err := product.Create(ctx, db, owner, product.NewProduct{Name: "Books", Cost: money.Money{Amount: 15, Currency: "EUR"}, Quantity: 3}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	// sold checks how many units of a Product have been sold and for how
+	// much.
+	sold := func(id string, units, revenue int) {
+		t.Helper()
+
+		p, err := product.Get(ctx, db, id)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if p.Sold != units || p.Revenue != tests.USD(revenue) {
+			t.Fatalf("expected %d sold for %d, got %d sold for %v", units, revenue, p.Sold, p.Revenue)
+		}
+	}
+
+	// The haggled price is split across the lines in proportion to their
+	// totals.
+	paid := tests.USD(80)
+	no := order.NewOrder{
+		Lines: []order.NewLine{
+			{ProductID: puzzles.ID, Quantity: 2},
+			{ProductID: toys.ID, Quantity: 1},
+		},
+		Paid: &paid,
+	}
+	o, err := order.Create(ctx, db, owner, no, now)
+	if err != nil {
+		t.Fatalf("creating order: %s", err)
+	}
+	if o.Total != tests.USD(90) || o.Paid != tests.USD(80) || len(o.Lines) != 2 {
+		t.Fatalf("expected an order of 2 lines totaling 90 paid 80, got %+v", o)
+	}
+	if o.Lines[0].Paid != tests.USD(44) || o.Lines[1].Paid != tests.USD(36) {
+		t.Fatalf("expected the lines to be paid 44 and 36, got %v and %v", o.Lines[0].Paid, o.Lines[1].Paid)
+	}
+	sold(puzzles.ID, 2, 44)
+	sold(toys.ID, 1, 36)
+
+	// Each line is a Sale of its Product.
+	sales, _, err := product.ListSales(ctx, db, puzzles.ID, database.Page{})
+	if err != nil {
+		t.Fatalf("listing sales: %s", err)
+	}
+	if len(sales) != 1 || sales[0].ID != o.Lines[0].SaleID {
+		t.Fatalf("expected the first line to be the sale of puzzles, got %+v", sales)
+	}
+
+	saved, err := order.Get(ctx, db, owner, o.ID)
+	if err != nil {
+		t.Fatalf("getting order: %s", err)
+	}
+	if diff := cmp.Diff(o, saved); diff != "" {
+		t.Fatalf("saved order did not match created. Diff:\n%s", diff)
+	}
+
+	r := saved.Receipt()
+	if r.Total != tests.USD(90) || r.Discount != tests.USD(10) || r.Paid != tests.USD(80) || r.Lines[1].Description != "Toys" {
+		t.Fatalf("unexpected receipt %+v", r)
+	}
+
+	// An Order is recorded completely or not at all.
+	no = order.NewOrder{
+		Lines: []order.NewLine{
+			{ProductID: puzzles.ID, Quantity: 1},
+			{ProductID: toys.ID, Quantity: 5},
+		},
+	}
+	if _, err := order.Create(ctx, db, owner, no, now); errors.Cause(err) != product.ErrInsufficientStock {
+		t.Fatalf("expected %v overselling, got %v", product.ErrInsufficientStock, err)
+	}
+	sold(puzzles.ID, 2, 44)
+
+	{ // Invalid orders
+
+		tooMuch := tests.USD(1000)
+		euros := money.Money{Amount: 10, Currency: "EUR"}
+		line := order.NewLine{ProductID: puzzles.ID, Quantity: 1}
+		invalid := []struct {
+			name string
+			user auth.Claims
+			no   order.NewOrder
+			err  error
+		}{
+			{"no lines", owner, order.NewOrder{}, order.ErrNoLines},
+			{"duplicate product", owner, order.NewOrder{Lines: []order.NewLine{line, line}}, order.ErrDuplicateProduct},
+			{"paid too much", owner, order.NewOrder{Lines: []order.NewLine{line}, Paid: &tooMuch}, order.ErrInvalidPaid},
+			{"paid in euros", owner, order.NewOrder{Lines: []order.NewLine{line}, Paid: &euros}, order.ErrInvalidPaid},
+			{"mixed currencies", owner, order.NewOrder{Lines: []order.NewLine{line, {ProductID: books.ID, Quantity: 1}}}, order.ErrMixedCurrencies},
+			{"unknown product", owner, order.NewOrder{Lines: []order.NewLine{{ProductID: "2bd3b2e5-c4a3-4a38-9e79-3f7fe8d0d0a5", Quantity: 1}}}, product.ErrNotFound},
+			{"not the owner", other, order.NewOrder{Lines: []order.NewLine{line}}, product.ErrForbidden},
+		}
+		for _, tt := range invalid {
+			if _, err := order.Create(ctx, db, tt.user, tt.no, now); errors.Cause(err) != tt.err {
+				t.Fatalf("%s: expected %v, got %v", tt.name, tt.err, err)
+			}
+		}
+	}
+
+	{ // Purging a Product sold in an Order keeps it so the Order adds up.
+
+		if err := product.Delete(ctx, db, owner, toys.ID, now); err != nil {
+			t.Fatalf("deleting product: %s", err)
+		}
+		store, cleanup := tests.NewImageStore(t)
+		defer cleanup()
+
+		n, err := product.Purge(ctx, db, store, now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("purging products: %s", err)
+		}
+		if n != 0 {
+			t.Fatalf("expected no products purged, got %d", n)
+		}
+		kept, err := order.Get(ctx, db, owner, o.ID)
+		if err != nil {
+			t.Fatalf("getting order: %s", err)
+		}
+		if diff := cmp.Diff(o, kept); diff != "" {
+			t.Fatalf("order changed by purge. Diff:\n%s", diff)
+		}
+	}
+
+	{ // Only the user who recorded an Order or an admin can see it.
+
+		if _, err := order.Get(ctx, db, other, o.ID); errors.Cause(err) != authz.ErrDenied {
+			t.Fatalf("expected %v getting another user's order, got %v", authz.ErrDenied, err)
+		}
+		admin := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+		if _, err := order.Get(ctx, db, admin, o.ID); err != nil {
+			t.Fatalf("getting order as admin: %s", err)
+		}
+		if _, err := order.Get(ctx, db, owner, "2bd3b2e5-c4a3-4a38-9e79-3f7fe8d0d0a5"); errors.Cause(err) != order.ErrNotFound {
+			t.Fatalf("expected %v getting an unknown order, got %v", order.ErrNotFound, err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package order
+
+import (
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+)
+
+// Actions which can be performed on Orders.
+const (
+	ActionView = "view"
+)
+
+// Policy decides who may see Orders. Users see the Orders they recorded and
+// admins see everyone's. Who may record an Order is decided by
+// product.Policy for each Product in it.
+var Policy = authz.Policy{
+	Kind: "order",
+	Rules: map[string]authz.Rule{
+		ActionView: authz.Any(authz.Owner, authz.Role(auth.RoleAdmin)),
+	},
+}
+
+// resource describes o to the Policy.
+func (o *Order) resource() authz.Resource {
+	return authz.Resource{ID: o.ID, OwnerID: o.UserID}
+}
@@ -0,0 +1,69 @@
+package order
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/money"
+)
+
+// Receipt is an Order as it is shown to the buyer. Discount is how much less
+// than the Total was paid.
+type Receipt struct {
+	OrderID  string        `json:"order_id"`
+	Date     time.Time     `json:"date"`
+	Lines    []ReceiptLine `json:"lines"`
+	Total    money.Money   `json:"total"`
+	Discount money.Money   `json:"discount"`
+	Paid     money.Money   `json:"paid"`
+}
+
+// ReceiptLine is one Product on a Receipt. Amount is Price times Quantity.
+type ReceiptLine struct {
+	Description string      `json:"description"`
+	Quantity    int         `json:"quantity"`
+	Price       money.Money `json:"price"`
+	Amount      money.Money `json:"amount"`
+}
+
+// Receipt gives the Receipt for o.
+func (o *Order) Receipt() Receipt {
+	r := Receipt{
+		OrderID:  o.ID,
+		Date:     o.DateCreated,
+		Lines:    make([]ReceiptLine, len(o.Lines)),
+		Total:    o.Total,
+		Discount: money.Money{Amount: o.Total.Amount - o.Paid.Amount, Currency: o.Total.Currency},
+		Paid:     o.Paid,
+	}
+	for i, l := range o.Lines {
+		r.Lines[i] = ReceiptLine{
+			Description: l.Name,
+			Quantity:    l.Quantity,
+			Price:       l.Cost,
+			Amount:      l.Total,
+		}
+	}
+	return r
+}
+
+// String lays out the Receipt as plain text for printing.
+func (r Receipt) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Order %s\n%s\n\n", r.OrderID, r.Date.Format("2006-01-02 15:04 MST"))
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, l := range r.Lines {
+		fmt.Fprintf(tw, "%s\t%d x\t%s\t%s\t\n", l.Description, l.Quantity, l.Price, l.Amount)
+	}
+	fmt.Fprintf(tw, "\t\tTotal\t%s\t\n", r.Total)
+	if r.Discount.Amount != 0 {
+		fmt.Fprintf(tw, "\t\tDiscount\t-%s\t\n", r.Discount)
+	}
+	fmt.Fprintf(tw, "\t\tPaid\t%s\t\n", r.Paid)
+	tw.Flush()
+
+	return buf.String()
+}
@@ -0,0 +1,107 @@
+package authz
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/pkg/errors"
+)
+
+// ErrDenied is the cause of every error returned when a policy denies an
+// action. The error which wraps it explains why, so the reason is logged
+// while clients only see this message.
+var ErrDenied = errors.New("you are not authorized for that action")
+
+func init() {
+	web.RegisterError(ErrDenied, http.StatusForbidden, "forbidden")
+}
+
+// Resource describes what an action is performed on. The zero Resource is
+// used when there is no particular resource, such as in middleware which
+// runs before a resource is loaded.
+type Resource struct {
+	ID      string
+	OwnerID string
+}
+
+// Rule decides whether a user may do something to a resource.
+type Rule struct {
+	desc  string
+	allow func(claims auth.Claims, res Resource) bool
+}
+
+// String describes what the rule requires.
+func (r Rule) String() string {
+	return r.desc
+}
+
+// Role allows users who have at least one of roles.
+func Role(roles ...string) Rule {
+	return Rule{
+		desc: "role " + strings.Join(roles, " or "),
+		allow: func(claims auth.Claims, res Resource) bool {
+			return claims.HasRole(roles...)
+		},
+	}
+}
+
+// Owner allows the user who owns the resource.
+var Owner = Rule{
+	desc: "owner",
+	allow: func(claims auth.Claims, res Resource) bool {
+		return res.OwnerID != "" && res.OwnerID == claims.Subject
+	},
+}
+
+// Any allows users who satisfy at least one of rules.
+func Any(rules ...Rule) Rule {
+	descs := make([]string, len(rules))
+	for i, r := range rules {
+		descs[i] = r.desc
+	}
+
+	return Rule{
+		desc: strings.Join(descs, " or "),
+		allow: func(claims auth.Claims, res Resource) bool {
+			for _, r := range rules {
+				if r.allow(claims, res) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// Policy holds the Rule for each action on one kind of resource.
+type Policy struct {
+
+	// Kind names the resource in denial reasons, for example "product".
+	Kind string
+
+	// Rules maps an action to the Rule which allows it. Actions without a
+	// Rule are always denied.
+	Rules map[string]Rule
+}
+
+// Check returns nil if claims allow action on res. Otherwise the error has
+// ErrDenied as its cause and says which user was denied and why.
+func (p Policy) Check(claims auth.Claims, action string, res Resource) error {
+	target := p.Kind
+	if res.ID != "" {
+		target += " " + res.ID
+	}
+
+	rule, ok := p.Rules[action]
+	if !ok {
+		return errors.Wrapf(ErrDenied, "user %q may not %s %s: no rule for action", claims.Subject, action, target)
+	}
+
+	if !rule.allow(claims, res) {
+		return errors.Wrapf(ErrDenied, "user %q may not %s %s: requires %s", claims.Subject, action, target, rule)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package authz_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+	"github.com/pkg/errors"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := authz.Policy{
+		Kind: "product",
+		Rules: map[string]authz.Rule{
+			"update": authz.Any(authz.Owner, authz.Role(auth.RoleAdmin)),
+			"sell":   authz.Owner,
+		},
+	}
+
+	now := time.Now()
+	owner := auth.NewClaims("owner", []string{auth.RoleUser}, now, time.Hour)
+	other := auth.NewClaims("other", []string{auth.RoleUser}, now, time.Hour)
+	admin := auth.NewClaims("admin", []string{auth.RoleAdmin}, now, time.Hour)
+
+	res := authz.Resource{ID: "p1", OwnerID: "owner"}
+
+	tests := []struct {
+		name    string
+		claims  auth.Claims
+		action  string
+		res     authz.Resource
+		allowed bool
+		reason  string
+	}{
+		{"owner updates", owner, "update", res, true, ""},
+		{"admin updates", admin, "update", res, true, ""},
+		{"other updates", other, "update", res, false, `user "other" may not update product p1: requires owner or role ADMIN: you are not authorized for that action`},
+		{"admin sells", admin, "sell", res, false, `user "admin" may not sell product p1: requires owner: you are not authorized for that action`},
+		{"no owner", other, "sell", authz.Resource{}, false, `user "other" may not sell product: requires owner: you are not authorized for that action`},
+		{"unknown action", admin, "purge", res, false, `user "admin" may not purge product p1: no rule for action: you are not authorized for that action`},
+	}
+
+	for _, tt := range tests {
+		err := policy.Check(tt.claims, tt.action, tt.res)
+		if tt.allowed {
+			if err != nil {
+				t.Errorf("%s: expected allowed, got %v", tt.name, err)
+			}
+			continue
+		}
+
+		if errors.Cause(err) != authz.ErrDenied {
+			t.Errorf("%s: expected %v, got %v", tt.name, authz.ErrDenied, err)
+			continue
+		}
+		if err.Error() != tt.reason {
+			t.Errorf("%s: expected reason %q, got %q", tt.name, tt.reason, err.Error())
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package authz decides whether an authenticated user may perform an action
+// on a resource by evaluating declarative policies.
+package authz
@@ -0,0 +1,143 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidKey is used when a key is empty, absolute or would escape the
+// store, such as one containing "..".
+var ErrInvalidKey = errors.New("blob key is not valid")
+
+// Store saves and removes blobs by key. Keys are slash separated paths like
+// "products/1/front.jpg". Implementations must be safe for concurrent use.
+type Store interface {
+
+	// Put saves the contents of r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+
+	// Delete removes the blob under key. Deleting a missing blob is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+
+	// URL gives the address clients can fetch the blob under key from.
+	URL(key string) string
+}
+
+// checkKey makes sure key is a clean relative path.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return errors.Wrapf(ErrInvalidKey, "key %q", key)
+	}
+	return nil
+}
+
+// Local is a Store which keeps blobs as files under a directory. It is also
+// an http.Handler which serves them, so it must be reachable at baseURL for
+// the URLs it gives to work.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal constructs a Local store which keeps blobs under dir and gives
+// URLs beginning with baseURL. The directory is created if it is missing.
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "creating blob directory %s", dir)
+	}
+
+	l := Local{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+	return &l, nil
+}
+
+// Put implements the Store interface. The blob is written to a temporary
+// file first so readers never see part of it. Local files carry no content
+// type so it is worked out from the key's extension when served.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	name := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", key)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".upload-")
+	if err != nil {
+		return errors.Wrapf(err, "creating file for %s", key)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "writing %s", key)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "writing %s", key)
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return errors.Wrapf(err, "saving %s", key)
+	}
+
+	return nil
+}
+
+// Delete implements the Store interface.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "deleting %s", key)
+	}
+
+	return nil
+}
+
+// URL implements the Store interface.
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+// ServeHTTP implements the http.Handler interface. It serves the blob whose
+// key is the request path, so any prefix such as baseURL must be stripped
+// first. Directories and temporary files are not served.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if checkKey(key) != nil || strings.HasPrefix(path.Base(key), ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,67 @@
+package blob
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := NewLocal(dir, "/v1/images/")
+	if err != nil {
+		t.Fatalf("creating store: %s", err)
+	}
+	ctx := context.Background()
+
+	const key = "products/1/front.txt"
+	if err := l.Put(ctx, key, strings.NewReader("front"), "text/plain"); err != nil {
+		t.Fatalf("putting blob: %s", err)
+	}
+	if got, want := l.URL(key), "/v1/images/products/1/front.txt"; got != want {
+		t.Fatalf("expected URL %q, got %q", want, got)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/" + key)
+	if w.Code != http.StatusOK || w.Body.String() != "front" {
+		t.Fatalf("expected 200 with the blob, got %d %q", w.Code, w.Body.String())
+	}
+	for _, path := range []string{"/products/1", "/products/../../etc/passwd", "/products/1/.upload-1"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s, got %d", path, w.Code)
+		}
+	}
+
+	for _, bad := range []string{"", "/abs", "../up", "a/../../up", "a//b"} {
+		if err := l.Put(ctx, bad, strings.NewReader("x"), "text/plain"); errors.Cause(err) != ErrInvalidKey {
+			t.Fatalf("expected ErrInvalidKey for %q, got %v", bad, err)
+		}
+	}
+
+	if err := l.Delete(ctx, key); err != nil {
+		t.Fatalf("deleting blob: %s", err)
+	}
+	if w := get("/" + key); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", w.Code)
+	}
+	if err := l.Delete(ctx, key); err != nil {
+		t.Fatalf("deleting a missing blob: %s", err)
+	}
+}
@@ -0,0 +1,3 @@
+// Package blob stores files, such as uploaded images, behind a pluggable
+// interface so they can live on local disk or in an object store.
+package blob
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cursor marks a position in ordered results. Key is the value the results
+// are ordered by, written as text, for the last row already seen. The ID of
+// that row breaks ties between rows with the same Key. Sort names the order
+// so a cursor cannot be used with a different one. Clients see a Cursor as
+// an opaque string.
+type Cursor struct {
+	Sort string
+	Key  string
+	ID   string
+}
+
+// MarshalText encodes the cursor as URL safe text.
+func (c Cursor) MarshalText() ([]byte, error) {
+	raw, err := json.Marshal([]string{c.Sort, c.Key, c.ID})
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding cursor")
+	}
+	return []byte(base64.RawURLEncoding.EncodeToString(raw)), nil
+}
+
+// UnmarshalText decodes a cursor produced by MarshalText.
+func (c *Cursor) UnmarshalText(text []byte) error {
+	raw, err := base64.RawURLEncoding.DecodeString(string(text))
+	if err != nil {
+		return errors.Wrap(err, "decoding cursor")
+	}
+
+	var parts []string
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return errors.Wrap(err, "decoding cursor")
+	}
+	if len(parts) != 3 || parts[2] == "" {
+		return errors.New("malformed cursor")
+	}
+
+	c.Sort = parts[0]
+	c.Key = parts[1]
+	c.ID = parts[2]
+	return nil
+}
+
+// String returns the encoded form of the cursor.
+func (c Cursor) String() string {
+	text, _ := c.MarshalText()
+	return string(text)
+}
+
+// TimeKey formats t for use as a Cursor Key.
+func TimeKey(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Page selects part of a result set. Results start after the After cursor, or
+// at the beginning when it is nil. A Limit of zero or less returns every
+// remaining result. When Until is set results end with the one it marks,
+// which lets a page be read once the cursor of the following page is known.
+type Page struct {
+	Limit int
+	After *Cursor
+	Until *Cursor
+}
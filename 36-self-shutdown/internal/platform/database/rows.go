@@ -0,0 +1,31 @@
+package database
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// Rows is a cursor over query results which scans each row into a new value.
+// It satisfies the web.Stream interface so results can be sent to a client
+// without loading them all into memory.
+type Rows struct {
+	*sqlx.Rows
+	newValue func() interface{}
+}
+
+// NewRows wraps rows. The newValue function must return a pointer to a fresh
+// struct for each row to be scanned into.
+func NewRows(rows *sqlx.Rows, newValue func() interface{}) *Rows {
+	return &Rows{
+		Rows:     rows,
+		newValue: newValue,
+	}
+}
+
+// Value scans the current row into a new value.
+func (r *Rows) Value() (interface{}, error) {
+	v := r.newValue()
+	if err := r.StructScan(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
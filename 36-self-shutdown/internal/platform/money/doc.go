@@ -0,0 +1,3 @@
+// Package money provides an amount of money in an ISO 4217 currency which can
+// be sent as JSON, stored in the database and validated in requests.
+package money
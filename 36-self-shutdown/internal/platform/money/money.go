@@ -0,0 +1,131 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+
+	// Requests name currencies with the iso4217 tag, which accepts the codes
+	// known to this package.
+	web.RegisterValidation("iso4217", IsCurrency, map[string]string{
+		"en": "{0} must be an ISO 4217 currency code",
+		"fr": "{0} doit être un code de devise ISO 4217",
+		"es": "{0} debe ser un código de moneda ISO 4217",
+		"de": "{0} muss ein ISO-4217-Währungscode sein",
+	})
+}
+
+// Money is an amount of a single currency. Amount is counted in the minor
+// unit of the currency, such as cents for USD, so it is always exact. Amounts
+// sent by clients may not be negative.
+//
+// In the database Money is stored in a column of the monetary type, which is
+// a composite of the amount and the currency.
+type Money struct {
+	Amount   int    `json:"amount" validate:"gte=0"`
+	Currency string `json:"currency" validate:"required,iso4217"`
+}
+
+// String implements the fmt.Stringer interface. The amount is written in the
+// major unit of the currency, such as "12.50 EUR".
+func (m Money) String() string {
+	digits, ok := currencies[m.Currency]
+	if !ok || digits == 0 {
+		return strings.TrimSpace(strconv.Itoa(m.Amount) + " " + m.Currency)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	unit := 1
+	for i := 0; i < digits; i++ {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/unit, digits, amount%unit, m.Currency)
+}
+
+// Value implements the driver.Valuer interface. It gives the text form of a
+// monetary value.
+func (m Money) Value() (driver.Value, error) {
+	return fmt.Sprintf("(%d,%s)", m.Amount, m.Currency), nil
+}
+
+// Scan implements the sql.Scanner interface. A NULL column gives the zero
+// Money.
+func (m *Money) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case nil:
+		*m = Money{}
+		return nil
+	default:
+		return errors.Errorf("cannot scan %T into Money", src)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(strings.TrimPrefix(text, "("), ")"), ",")
+	if len(fields) != 2 {
+		return errors.Errorf("scanning money: malformed value %q", text)
+	}
+
+	var scanned Money
+	if fields[0] != "" {
+		amount, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return errors.Wrapf(err, "scanning money %q", text)
+		}
+		scanned.Amount = amount
+	}
+	scanned.Currency = strings.TrimSpace(fields[1])
+
+	*m = scanned
+	return nil
+}
+
+// IsCurrency reports whether code is an active ISO 4217 currency code.
+func IsCurrency(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// currencies maps each active ISO 4217 currency code to the number of digits
+// in its minor unit. Codes for precious metals and testing are left out.
+var currencies = map[string]int{
+	"AED": 2, "AFN": 2, "ALL": 2, "AMD": 2, "AOA": 2, "ARS": 2, "AUD": 2,
+	"AWG": 2, "AZN": 2, "BAM": 2, "BBD": 2, "BDT": 2, "BGN": 2, "BHD": 3,
+	"BIF": 0, "BMD": 2, "BND": 2, "BOB": 2, "BOV": 2, "BRL": 2, "BSD": 2,
+	"BTN": 2, "BWP": 2, "BYN": 2, "BZD": 2, "CAD": 2, "CDF": 2, "CHE": 2,
+	"CHF": 2, "CHW": 2, "CLF": 4, "CLP": 0, "CNY": 2, "COP": 2, "COU": 2,
+	"CRC": 2, "CUP": 2, "CVE": 2, "CZK": 2, "DJF": 0, "DKK": 2, "DOP": 2,
+	"DZD": 2, "EGP": 2, "ERN": 2, "ETB": 2, "EUR": 2, "FJD": 2, "FKP": 2,
+	"GBP": 2, "GEL": 2, "GHS": 2, "GIP": 2, "GMD": 2, "GNF": 0, "GTQ": 2,
+	"GYD": 2, "HKD": 2, "HNL": 2, "HTG": 2, "HUF": 2, "IDR": 2, "ILS": 2,
+	"INR": 2, "IQD": 3, "IRR": 2, "ISK": 0, "JMD": 2, "JOD": 3, "JPY": 0,
+	"KES": 2, "KGS": 2, "KHR": 2, "KMF": 0, "KPW": 2, "KRW": 0, "KWD": 3,
+	"KYD": 2, "KZT": 2, "LAK": 2, "LBP": 2, "LKR": 2, "LRD": 2, "LSL": 2,
+	"LYD": 3, "MAD": 2, "MDL": 2, "MGA": 2, "MKD": 2, "MMK": 2, "MNT": 2,
+	"MOP": 2, "MRU": 2, "MUR": 2, "MVR": 2, "MWK": 2, "MXN": 2, "MXV": 2,
+	"MYR": 2, "MZN": 2, "NAD": 2, "NGN": 2, "NIO": 2, "NOK": 2, "NPR": 2,
+	"NZD": 2, "OMR": 3, "PAB": 2, "PEN": 2, "PGK": 2, "PHP": 2, "PKR": 2,
+	"PLN": 2, "PYG": 0, "QAR": 2, "RON": 2, "RSD": 2, "RUB": 2, "RWF": 0,
+	"SAR": 2, "SBD": 2, "SCR": 2, "SDG": 2, "SEK": 2, "SGD": 2, "SHP": 2,
+	"SLE": 2, "SOS": 2, "SRD": 2, "SSP": 2, "STN": 2, "SVC": 2, "SYP": 2,
+	"SZL": 2, "THB": 2, "TJS": 2, "TMT": 2, "TND": 3, "TOP": 2, "TRY": 2,
+	"TTD": 2, "TWD": 2, "TZS": 2, "UAH": 2, "UGX": 0, "USD": 2, "USN": 2,
+	"UYI": 0, "UYU": 2, "UYW": 4, "UZS": 2, "VED": 2, "VES": 2, "VND": 0,
+	"VUV": 0, "WST": 2, "XAF": 0, "XCD": 2, "XCG": 2, "XOF": 0, "XPF": 0,
+	"YER": 2, "ZAR": 2, "ZMW": 2, "ZWG": 2,
+}
@@ -0,0 +1,107 @@
+package money
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Money{1250, "EUR"}, "12.50 EUR"},
+		{Money{5, "USD"}, "0.05 USD"},
+		{Money{-1050, "USD"}, "-10.50 USD"},
+		{Money{1500, "JPY"}, "1500 JPY"},
+		{Money{12345, "KWD"}, "12.345 KWD"},
+		{Money{42, ""}, "42"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("%#v: expected %q, got %q", tt.m, tt.want, got)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	m := Money{Amount: 1250, Currency: "EUR"}
+
+	v, err := m.Value()
+	if err != nil {
+		t.Fatalf("getting value: %s", err)
+	}
+
+	var got Money
+	if err := got.Scan([]byte(v.(string))); err != nil {
+		t.Fatalf("scanning %q: %s", v, err)
+	}
+	if got != m {
+		t.Fatalf("expected %v after a round trip, got %v", m, got)
+	}
+
+	if err := got.Scan(nil); err != nil || got != (Money{}) {
+		t.Fatalf("expected NULL to scan as zero, got %v, %v", got, err)
+	}
+	if err := got.Scan([]byte("(,USD)")); err != nil || got != (Money{Currency: "USD"}) {
+		t.Fatalf("expected a NULL amount to scan as zero, got %v, %v", got, err)
+	}
+	for _, bad := range []interface{}{[]byte("(12)"), []byte("(x,USD)"), 12} {
+		if err := got.Scan(bad); err == nil {
+			t.Fatalf("expected an error scanning %v", bad)
+		}
+	}
+}
+
+func TestIsCurrency(t *testing.T) {
+	for _, code := range []string{"USD", "EUR", "JPY"} {
+		if !IsCurrency(code) {
+			t.Errorf("expected %s to be a currency", code)
+		}
+	}
+	for _, code := range []string{"", "usd", "XYZ", "EURO"} {
+		if IsCurrency(code) {
+			t.Errorf("expected %q not to be a currency", code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		body string
+		want []web.FieldError
+	}{
+		{`{"price":{"amount":1250,"currency":"EUR"}}`, nil},
+		{`{"price":{"amount":1250,"currency":"XYZ"}}`, []web.FieldError{
+			{Field: "currency", Error: "currency must be an ISO 4217 currency code"},
+		}},
+		{`{"price":{"amount":-5,"currency":"USD"}}`, []web.FieldError{
+			{Field: "amount", Error: "amount must be 0 or greater"},
+		}},
+		{`{}`, []web.FieldError{
+			{Field: "currency", Error: "currency is a required field"},
+		}},
+	}
+
+	for _, tt := range tests {
+		var v struct {
+			Price Money `json:"price"`
+		}
+
+		err := web.Decode(httptest.NewRequest("POST", "/", strings.NewReader(tt.body)), &v)
+
+		var fields []web.FieldError
+		if webErr, ok := err.(*web.Error); ok {
+			fields = webErr.Fields
+		} else if err != nil {
+			t.Fatalf("%s: expected a *web.Error, got %v", tt.body, err)
+		}
+		if diff := cmp.Diff(tt.want, fields); diff != "" {
+			t.Fatalf("%s: fields did not match expected. Diff:\n%s", tt.body, diff)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+// Package ratelimit provides token bucket rate limiting with pluggable storage.
+package ratelimit
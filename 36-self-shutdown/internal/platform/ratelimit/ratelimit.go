@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limit allows Requests requests every Per. Unused allowance accumulates up
+// to Requests so short bursts are permitted. A Limit with zero Requests or
+// Per is disabled.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Enabled reports whether the limit should be enforced.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// Validate reports whether an enabled limit can be enforced. Buckets refill
+// one token every Per divided by Requests, which must be at least a
+// nanosecond.
+func (l Limit) Validate() error {
+	if l.Enabled() && l.interval() <= 0 {
+		return errors.Errorf("rate limit of %d requests per %v is too fine to enforce", l.Requests, l.Per)
+	}
+	return nil
+}
+
+// interval is the time it takes for one token to be added to a bucket.
+func (l Limit) interval() time.Duration {
+	return l.Per / time.Duration(l.Requests)
+}
+
+// Result describes the state of a bucket after a request has been counted.
+type Result struct {
+
+	// Allowed is false when the bucket was empty and the request must be
+	// rejected.
+	Allowed bool
+
+	// Remaining is how many more requests are allowed right now.
+	Remaining int
+
+	// RetryAfter is how long to wait before a rejected request would be
+	// allowed. It is zero for allowed requests.
+	RetryAfter time.Duration
+
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store holds the buckets for every key. Implementations must be safe for
+// concurrent use. A Store shared by several replicas enforces one limit
+// across all of them.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// bucket records how full a bucket was at a point in time and how long it
+// takes to refill.
+type bucket struct {
+	tokens float64
+	at     time.Time
+	per    time.Duration
+}
+
+// Memory is a Store which keeps buckets in process memory. Each process
+// enforces limits independently.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewMemory constructs an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// sweepEvery is how often Memory drops buckets which have refilled. A full
+// bucket is indistinguishable from a missing one.
+const sweepEvery = time.Minute
+
+// Take removes a token from the bucket for key if one is available.
+func (m *Memory) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	if err := l.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.swept) > sweepEvery {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Requests), at: now, per: l.Per}
+		m.buckets[key] = b
+	}
+
+	// Add the tokens earned since the bucket was last touched.
+	interval := l.interval()
+	b.tokens += float64(now.Sub(b.at)) / float64(interval)
+	if max := float64(l.Requests); b.tokens > max {
+		b.tokens = max
+	}
+	b.at = now
+	b.per = l.Per
+
+	var res Result
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) * float64(interval))
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(l.Requests) - b.tokens) * float64(interval))
+
+	return res, nil
+}
+
+// sweep deletes buckets which have had time to refill completely.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.at) >= b.per {
+			delete(m.buckets, key)
+		}
+	}
+	m.swept = now
+}
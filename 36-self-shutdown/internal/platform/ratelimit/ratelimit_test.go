@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryTake(t *testing.T) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	l := Limit{Requests: 2, Per: time.Minute}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		key       string
+		allowed   bool
+		remaining int
+		retry     time.Duration
+	}{
+		{"first", 0, "a", true, 1, 0},
+		{"second", 0, "a", true, 0, 0},
+		{"empty", 0, "a", false, 0, 30 * time.Second},
+		{"other key", 0, "b", true, 1, 0},
+		{"partial refill", 10 * time.Second, "a", false, 0, 20 * time.Second},
+		{"refilled", 20 * time.Second, "a", true, 0, 0},
+		{"full after idle", 5 * time.Minute, "a", true, 1, 0},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+
+		res, err := m.Take(ctx, tt.key, l)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if res.Allowed != tt.allowed {
+			t.Errorf("%s: allowed = %v, want %v", tt.name, res.Allowed, tt.allowed)
+		}
+		if res.Remaining != tt.remaining {
+			t.Errorf("%s: remaining = %d, want %d", tt.name, res.Remaining, tt.remaining)
+		}
+		if res.RetryAfter != tt.retry {
+			t.Errorf("%s: retry after = %v, want %v", tt.name, res.RetryAfter, tt.retry)
+		}
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if _, err := m.Take(ctx, "a", Limit{Requests: 1, Per: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Take(ctx, "b", Limit{Requests: 1, Per: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := m.Take(ctx, "c", Limit{Requests: 1, Per: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.buckets["a"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := m.buckets["b"]; !ok {
+		t.Error("bucket still refilling was swept")
+	}
+}
+
+func TestLimitValidate(t *testing.T) {
+	tests := []struct {
+		l     Limit
+		valid bool
+	}{
+		{Limit{}, true},
+		{Limit{Requests: 10, Per: time.Second}, true},
+		{Limit{Requests: 1000, Per: time.Microsecond}, true},
+		{Limit{Requests: 1001, Per: time.Microsecond}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.l.Validate(); (err == nil) != tt.valid {
+			t.Fatalf("%+v: expected valid to be %v, got error %v", tt.l, tt.valid, err)
+		}
+	}
+
+	// Memory refuses a limit it cannot enforce rather than dividing by zero.
+	if _, err := NewMemory().Take(context.Background(), "a", Limit{Requests: 2, Per: 1}); err == nil {
+		t.Fatal("expected an error taking from a limit which is too fine")
+	}
+}
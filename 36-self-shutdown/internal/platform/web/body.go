@@ -0,0 +1,74 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// bodyTooLarge is returned when reading a request body beyond its limit.
+type bodyTooLarge struct {
+	limit int64
+}
+
+// Error is the implementation of the error interface.
+func (b *bodyTooLarge) Error() string {
+	return fmt.Sprintf("request body must not be larger than %d bytes", b.limit)
+}
+
+// limitedBody is a request body which fails once more than limit bytes are
+// read from it.
+type limitedBody struct {
+	rc    io.ReadCloser
+	limit int64
+	read  int64
+	err   error
+}
+
+// Read implements the io.Reader interface. It reads one byte more than the
+// limit allows so a body of exactly limit bytes is not rejected.
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	remaining := l.limit - l.read
+	if remaining < 0 {
+		remaining = 0
+	}
+	if int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+
+	n, err := l.rc.Read(p)
+	if int64(n) <= remaining {
+		l.read += int64(n)
+		l.err = err
+		return n, err
+	}
+
+	l.read += remaining
+	l.err = &bodyTooLarge{limit: l.limit}
+	return int(remaining), l.err
+}
+
+// Close implements the io.Closer interface.
+func (l *limitedBody) Close() error {
+	return l.rc.Close()
+}
+
+// LimitBody restricts the request body to n bytes. Reading past the limit
+// fails and Decode responds with 413 Request Entity Too Large. Calling it
+// again for the same request replaces the limit, so a route can raise or
+// lower a limit set for the whole application.
+func LimitBody(r *http.Request, n int64) {
+	if l, ok := r.Body.(*limitedBody); ok {
+		l.limit = n
+		return
+	}
+
+	r.Body = &limitedBody{rc: r.Body, limit: n}
+}
@@ -0,0 +1,485 @@
+package web
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotAcceptable is used when none of the registered encoders can produce a
+// media type the client accepts.
+var ErrNotAcceptable = errors.New("none of the requested media types are supported")
+
+// Encoder writes a Go value to a response body in a single media type.
+type Encoder func(w io.Writer, data interface{}) error
+
+// ValueWriter writes a sequence of values to a response body one at a time.
+// Close finishes the document after the last value.
+type ValueWriter interface {
+	Write(v interface{}) error
+	Close() error
+}
+
+// StreamEncoder starts writing a sequence of values to w in a single media
+// type. It is used by RespondStream.
+type StreamEncoder func(w io.Writer) ValueWriter
+
+// encoding pairs the Encoder and StreamEncoder for the media type they
+// produce. Either may be nil if the media type does not support it.
+type encoding struct {
+	mediaType   string
+	contentType string
+	encode      Encoder
+	stream      StreamEncoder
+}
+
+// encodings holds every registered encoding in the order it was registered.
+// The first entry is used when the client does not state a preference.
+var encodings struct {
+	sync.RWMutex
+	list []encoding
+}
+
+func init() {
+	RegisterEncoder("application/json; charset=utf-8", EncodeJSON)
+	RegisterEncoder("text/csv; charset=utf-8", EncodeCSV)
+	RegisterEncoder("application/x-ndjson; charset=utf-8", EncodeNDJSON)
+	RegisterEncoder("text/plain; charset=utf-8", EncodeText)
+
+	RegisterStreamEncoder("application/json; charset=utf-8", StreamJSON)
+	RegisterStreamEncoder("text/csv; charset=utf-8", StreamCSV)
+	RegisterStreamEncoder("application/x-ndjson; charset=utf-8", StreamNDJSON)
+}
+
+// RegisterEncoder makes an Encoder available to Respond for the media type in
+// contentType. The full contentType, including any parameters, is sent in the
+// Content-Type header. Registering a media type a second time replaces the
+// previous Encoder.
+func RegisterEncoder(contentType string, enc Encoder) {
+	register(contentType, func(e *encoding) { e.encode = enc })
+}
+
+// RegisterStreamEncoder makes a StreamEncoder available to RespondStream for
+// the media type in contentType. It follows the same rules as RegisterEncoder.
+func RegisterStreamEncoder(contentType string, enc StreamEncoder) {
+	register(contentType, func(e *encoding) { e.stream = enc })
+}
+
+// register finds or creates the encoding for the media type in contentType
+// and applies set to it.
+func register(contentType string, set func(e *encoding)) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		panic(fmt.Sprintf("web: invalid content type %q: %v", contentType, err))
+	}
+
+	encodings.Lock()
+	defer encodings.Unlock()
+
+	for i := range encodings.list {
+		if encodings.list[i].mediaType == mediaType {
+			encodings.list[i].contentType = contentType
+			set(&encodings.list[i])
+			return
+		}
+	}
+
+	e := encoding{
+		mediaType:   mediaType,
+		contentType: contentType,
+	}
+	set(&e)
+	encodings.list = append(encodings.list, e)
+}
+
+// mediaRange is a single entry from an Accept header.
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// match reports how specifically the range matches mediaType: 2 for an exact
+// match, 1 for a type/* match, 0 for */* and -1 when it does not match.
+func (mr mediaRange) match(mediaType string) int {
+	switch {
+	case mr.mediaType == mediaType:
+		return 2
+	case mr.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mr.mediaType, "/*") &&
+		strings.HasPrefix(mediaType, strings.TrimSuffix(mr.mediaType, "*")):
+		return 1
+	}
+	return -1
+}
+
+// parseAccept splits an Accept header into its media ranges. Malformed
+// entries are ignored.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// negotiate picks the registered encoding that best satisfies an Accept
+// header. Higher quality values win, then more specific ranges, then ranges
+// listed earlier by the client, then encodings registered earlier. It reports
+// false if the client accepts none of them. When streaming is true only
+// encodings with a StreamEncoder are considered.
+//
+// Asking for application/problem+json only chooses the form of errors, so a
+// client which accepts nothing else gets the first encoding, plain JSON.
+func negotiate(accept string, streaming bool) (encoding, bool) {
+	encodings.RLock()
+	defer encodings.RUnlock()
+
+	var candidates []encoding
+	for _, e := range encodings.list {
+		if streaming && e.stream != nil || !streaming && e.encode != nil {
+			candidates = append(candidates, e)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return encoding{}, false
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return candidates[0], true
+	}
+	ranges := parseAccept(accept)
+
+	var (
+		best         encoding
+		found        bool
+		bestQ        float64
+		bestSpecific int
+		bestPosition int
+	)
+
+	for _, e := range candidates {
+
+		// Find the most specific range which matches this encoding. The quality
+		// of that range is the quality of the encoding.
+		specific, position, q := -1, 0, 0.0
+		for i, mr := range ranges {
+			if m := mr.match(e.mediaType); m > specific {
+				specific, position, q = m, i, mr.q
+			}
+		}
+		if specific < 0 || q <= 0 {
+			continue
+		}
+
+		better := !found ||
+			q > bestQ ||
+			q == bestQ && specific > bestSpecific ||
+			q == bestQ && specific == bestSpecific && position < bestPosition
+		if better {
+			best, found = e, true
+			bestQ, bestSpecific, bestPosition = q, specific, position
+		}
+	}
+
+	if !found && wantsProblem(accept) {
+		return candidates[0], true
+	}
+
+	return best, found
+}
+
+// EncodeJSON writes data as a single JSON document.
+func EncodeJSON(w io.Writer, data interface{}) error {
+	res, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(res)
+	return err
+}
+
+// EncodeNDJSON writes data as newline delimited JSON. Each element of a slice
+// or array is written as its own line. Any other value is written as a single
+// line.
+func EncodeNDJSON(w io.Writer, data interface{}) error {
+	enc := json.NewEncoder(w)
+
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return enc.Encode(data)
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if err := enc.Encode(v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeText writes a value which describes itself with a String method as
+// plain text. Other values cause a 406 error.
+func EncodeText(w io.Writer, data interface{}) error {
+	s, ok := data.(fmt.Stringer)
+	if !ok {
+		err := errors.New("response cannot be represented as plain text")
+		return NewRequestError(err, http.StatusNotAcceptable)
+	}
+
+	_, err := io.WriteString(w, s.String())
+	return err
+}
+
+// EncodeCSV writes a struct, or a slice of structs, as CSV with a header row.
+// Column names come from the `csv` struct tag, falling back to the `json` tag
+// and then the field name. A tag of "-" skips the field. Embedded structs are
+// flattened into their fields. Values which are not
+// shaped like a table cause a 406 error.
+func EncodeCSV(w io.Writer, data interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(data))
+
+	var (
+		t    reflect.Type
+		rows []reflect.Value
+	)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		t = v.Type().Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, reflect.Indirect(v.Index(i)))
+		}
+	case reflect.Struct:
+		t = v.Type()
+		rows = append(rows, v)
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		err := errors.New("response cannot be represented as CSV")
+		return NewRequestError(err, http.StatusNotAcceptable)
+	}
+
+	cols, names := csvColumns(t)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(names); err != nil {
+		return err
+	}
+
+	record := make([]string, len(cols))
+	for _, row := range rows {
+
+		// Skip nil pointers in a slice of pointers.
+		if !row.IsValid() {
+			continue
+		}
+
+		for i, col := range cols {
+			record[i] = csvValue(row.FieldByIndex(col))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// StreamJSON writes a sequence of values as the elements of a JSON array.
+func StreamJSON(w io.Writer) ValueWriter {
+	return &jsonArrayWriter{w: w}
+}
+
+// jsonArrayWriter writes each value as one element of a JSON array.
+type jsonArrayWriter struct {
+	w io.Writer
+	n int
+}
+
+// Write adds v to the array, opening it first if needed.
+func (j *jsonArrayWriter) Write(v interface{}) error {
+	res, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	sep := ","
+	if j.n == 0 {
+		sep = "["
+	}
+	j.n++
+
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(res)
+	return err
+}
+
+// Close terminates the array. An empty sequence produces [].
+func (j *jsonArrayWriter) Close() error {
+	end := "]"
+	if j.n == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// StreamNDJSON writes a sequence of values as newline delimited JSON.
+func StreamNDJSON(w io.Writer) ValueWriter {
+	return ndjsonWriter{json.NewEncoder(w)}
+}
+
+// ndjsonWriter writes each value as its own line of JSON.
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+// Write adds v as a new line.
+func (n ndjsonWriter) Write(v interface{}) error {
+	return n.enc.Encode(v)
+}
+
+// Close does nothing since NDJSON has no closing delimiter.
+func (n ndjsonWriter) Close() error {
+	return nil
+}
+
+// StreamCSV writes a sequence of structs as CSV. The header row is taken from
+// the type of the first value and every value must be of that type. An empty
+// sequence produces no output.
+func StreamCSV(w io.Writer) ValueWriter {
+	return &csvWriter{cw: csv.NewWriter(w)}
+}
+
+// csvWriter writes each value as one CSV record.
+type csvWriter struct {
+	cw   *csv.Writer
+	t    reflect.Type
+	cols [][]int
+}
+
+// Write adds v as a record, writing the header row first if needed.
+func (c *csvWriter) Write(v interface{}) error {
+	row := reflect.Indirect(reflect.ValueOf(v))
+
+	if c.t == nil {
+		if row.Kind() != reflect.Struct {
+			return errors.New("response cannot be represented as CSV")
+		}
+
+		var names []string
+		c.t = row.Type()
+		c.cols, names = csvColumns(c.t)
+		if err := c.cw.Write(names); err != nil {
+			return err
+		}
+	}
+
+	if row.Type() != c.t {
+		return errors.Errorf("csv stream of %v got a %v", c.t, row.Type())
+	}
+
+	record := make([]string, len(c.cols))
+	for i, col := range c.cols {
+		record[i] = csvValue(row.FieldByIndex(col))
+	}
+	return c.cw.Write(record)
+}
+
+// Close flushes any buffered records.
+func (c *csvWriter) Close() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+// csvColumns returns the index paths and header names of the fields in t
+// which should appear in CSV output. The fields of an embedded struct without
+// a tag are included as if they were fields of t, as encoding/json does.
+func csvColumns(t reflect.Type) ([][]int, []string) {
+	var (
+		cols  [][]int
+		names []string
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get("csv") == "" && f.Tag.Get("json") == "" {
+			inner, innerNames := csvColumns(f.Type)
+			for _, col := range inner {
+				cols = append(cols, append([]int{i}, col...))
+			}
+			names = append(names, innerNames...)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag := f.Tag.Get("csv"); tag != "" {
+			name = strings.SplitN(tag, ",", 2)[0]
+		} else if tag := f.Tag.Get("json"); tag != "" {
+			if n := strings.SplitN(tag, ",", 2)[0]; n != "" {
+				name = n
+			}
+		}
+		if name == "-" {
+			continue
+		}
+
+		cols = append(cols, []int{i})
+		names = append(names, name)
+	}
+
+	return cols, names
+}
+
+// csvValue formats a single field for CSV output.
+func csvValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch val := v.Interface().(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return val.String()
+	}
+
+	return fmt.Sprint(v.Interface())
+}
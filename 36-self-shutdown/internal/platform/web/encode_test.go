@@ -0,0 +1,137 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", "application/json", true},
+		{"*/*", "application/json", true},
+		{"application/json", "application/json", true},
+		{"text/csv", "text/csv", true},
+		{"text/*", "text/csv", true},
+		{"application/x-ndjson", "application/x-ndjson", true},
+		{"text/plain", "text/plain", true},
+		{"text/csv, application/json", "text/csv", true},
+		{"text/csv;q=0.5, application/json", "application/json", true},
+		{"*/*;q=0.1, text/csv", "text/csv", true},
+		{"application/json;q=0, */*", "text/csv", true},
+		{"image/png", "", false},
+		{"text/html, image/*", "", false},
+	}
+
+	for _, tt := range tests {
+		e, ok := negotiate(tt.accept, false)
+		if ok != tt.ok {
+			t.Fatalf("%q: expected ok %v, got %v", tt.accept, tt.ok, ok)
+		}
+		if e.mediaType != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.accept, tt.want, e.mediaType)
+		}
+	}
+}
+
+type row struct {
+	ID      string    `json:"id"`
+	Name    string    `csv:"title" json:"name"`
+	Cost    int       `json:"cost"`
+	Secret  string    `json:"-"`
+	Created time.Time `json:"date_created"`
+}
+
+func TestEncodeCSV(t *testing.T) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	rows := []row{
+		{ID: "1", Name: "Comic, Books", Cost: 50, Secret: "x", Created: now},
+		{ID: "2", Name: "Toys", Cost: 75, Created: now},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeCSV(&buf, rows); err != nil {
+		t.Fatalf("encoding: %s", err)
+	}
+
+	want := "id,title,cost,date_created\n" +
+		"1,\"Comic, Books\",50,2019-01-01T00:00:00Z\n" +
+		"2,Toys,75,2019-01-01T00:00:00Z\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	// Embedded structs are flattened into their fields.
+	ranked := []struct {
+		row
+		Rank float64 `json:"rank"`
+	}{
+		{row: rows[1], Rank: 0.5},
+	}
+
+	buf.Reset()
+	if err := EncodeCSV(&buf, ranked); err != nil {
+		t.Fatalf("encoding: %s", err)
+	}
+
+	want = "id,title,cost,date_created,rank\n" +
+		"2,Toys,75,2019-01-01T00:00:00Z,0.5\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if err := EncodeCSV(&buf, map[string]string{"token": "abc"}); err == nil {
+		t.Fatal("encoding a map as CSV should return an error")
+	}
+}
+
+func TestEncodeNDJSON(t *testing.T) {
+	rows := []struct {
+		ID int `json:"id"`
+	}{{1}, {2}}
+
+	var buf bytes.Buffer
+	if err := EncodeNDJSON(&buf, rows); err != nil {
+		t.Fatalf("encoding: %s", err)
+	}
+
+	want := "{\"id\":1}\n{\"id\":2}\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeText(&buf, time.Duration(90)*time.Second); err != nil {
+		t.Fatalf("encoding: %s", err)
+	}
+	if got := buf.String(); got != "1m30s" {
+		t.Fatalf("expected %q, got %q", "1m30s", got)
+	}
+
+	err := EncodeText(&buf, []row{})
+	if webErr, ok := err.(*Error); !ok || webErr.Status != http.StatusNotAcceptable {
+		t.Fatalf("expected a 406 error for a value without a String method, got %v", err)
+	}
+}
+
+func TestRespondNotAcceptable(t *testing.T) {
+	v := Values{Accept: "image/png"}
+	ctx := context.WithValue(context.Background(), KeyValues, &v)
+	resp := httptest.NewRecorder()
+
+	err := Respond(ctx, resp, []row{}, http.StatusOK)
+
+	webErr, ok := err.(*Error)
+	if !ok || webErr.Status != http.StatusNotAcceptable {
+		t.Fatalf("expected a 406 error, got %v", err)
+	}
+}
@@ -5,29 +5,35 @@ import (
 )
 
 // FieldError is used to indicate an error with a specific request field.
+// When no field applies, such as for malformed JSON, Offset holds the byte
+// offset in the request body where the problem was found.
 type FieldError struct {
-	Field string `json:"field"`
-	Error string `json:"error"`
+	Field  string `json:"field,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Error  string `json:"error"`
 }
 
 // ErrorResponse is the form used for API responses from failures in the API.
 type ErrorResponse struct {
 	Error  string       `json:"error"`
+	Code   string       `json:"code"`
 	Fields []FieldError `json:"fields,omitempty"`
 }
 
 // Error is used to pass an error during the request through the
-// application with web specific context.
+// application with web specific context. Code is a stable machine readable
+// identifier for the error. If it is blank one is derived from Status.
 type Error struct {
 	Err    error
 	Status int
+	Code   string
 	Fields []FieldError
 }
 
 // NewRequestError wraps a provided error with an HTTP status code. This
 // function should be used when handlers encounter expected errors.
 func NewRequestError(err error, status int) error {
-	return &Error{err, status, nil}
+	return &Error{Err: err, Status: status}
 }
 
 // Error implements the error interface. It uses the default message of the
@@ -36,6 +42,47 @@ func (err *Error) Error() string {
 	return err.Err.Error()
 }
 
+// streamError is used when a streamed response fails after the status code
+// was sent. There is no way left to answer the client so it is only logged.
+type streamError struct {
+	err error
+}
+
+// Error is the implementation of the error interface.
+func (s *streamError) Error() string {
+	return "streaming response: " + s.err.Error()
+}
+
+// isStreamError checks to see if a streamError is contained in the
+// specified error value.
+func isStreamError(err error) bool {
+	var found bool
+	walk(err, func(err error) bool {
+		_, found = err.(*streamError)
+		return found
+	})
+	return found
+}
+
+// walk calls fn for err and then for each error it wraps, from the outermost
+// to the innermost, until fn returns true.
+func walk(err error, fn func(err error) bool) {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		if fn(err) {
+			return
+		}
+		c, ok := err.(causer)
+		if !ok {
+			return
+		}
+		err = c.Cause()
+	}
+}
+
 // shutdown is a type used to help with the graceful termination of the service.
 type shutdown struct {
 	Message string
@@ -0,0 +1,34 @@
+package web
+
+// Group is a set of routes which share a URL prefix and Middleware. It lets
+// routes that need the same treatment, like authentication, declare it once.
+type Group struct {
+	app    *App
+	prefix string
+	mw     []Middleware
+}
+
+// Handle associates a handler function with an HTTP Method and a URL pattern
+// relative to the group prefix. Handler specific Middleware runs after the
+// group Middleware.
+func (g *Group) Handle(method, url string, h Handler, mw ...Middleware) {
+	g.app.Handle(method, g.prefix+url, h, g.chain(mw)...)
+}
+
+// Group creates a nested Group. Its prefix is appended to this group's prefix
+// and its Middleware runs after this group's Middleware.
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		app:    g.app,
+		prefix: g.prefix + prefix,
+		mw:     g.chain(mw),
+	}
+}
+
+// chain returns the group Middleware followed by mw. It always allocates a
+// new slice so groups never share a backing array.
+func (g *Group) chain(mw []Middleware) []Middleware {
+	all := make([]Middleware, 0, len(g.mw)+len(mw))
+	all = append(all, g.mw...)
+	return append(all, mw...)
+}
@@ -0,0 +1,229 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	ut "github.com/go-playground/universal-translator"
+)
+
+// DecodeParams binds the URL path parameters of a request into val, which
+// must be a pointer to a struct. Fields are matched by their `path` tag, for
+// example `path:"id"`. The struct is then checked for validation tags the
+// same way as in Decode.
+func DecodeParams(r *http.Request, val interface{}) error {
+	lookup := func(name string) []string {
+		if v := chi.URLParam(r, name); v != "" {
+			return []string{v}
+		}
+		return nil
+	}
+
+	if err := bind(r, val, "path", lookup); err != nil {
+		return err
+	}
+
+	return check(r, val)
+}
+
+// DecodeQuery binds the query string of a request into val, which must be a
+// pointer to a struct. Fields are matched by their `query` tag, for example
+// `query:"limit"`. Slice fields receive every value of a repeated parameter.
+// Parameters which are not present leave their field unchanged so defaults
+// can be set before calling. The struct is then checked for validation tags
+// the same way as in Decode.
+func DecodeQuery(r *http.Request, val interface{}) error {
+	q := r.URL.Query()
+	lookup := func(name string) []string {
+		return q[name]
+	}
+
+	if err := bind(r, val, "query", lookup); err != nil {
+		return err
+	}
+
+	return check(r, val)
+}
+
+// bind sets each field of the struct val points to which has a tag named key
+// from the values returned by lookup. Values which cannot be parsed into
+// their field are reported together as a 400 *Error, in the language of the
+// request r like validation errors.
+func bind(r *http.Request, val interface{}, key string, lookup func(name string) []string) error {
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("web: binding %s values requires a pointer to a struct, got %T", key, val)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	lang := findTranslator(r.Header.Get("Accept-Language"))
+	english, _ := translator.GetTranslator("en")
+
+	var fields []FieldError
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get(key)
+		if name == "" || name == "-" {
+			continue
+		}
+
+		values := lookup(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		if err := setField(v.Field(i), values); err != nil {
+			msg := fmt.Sprintf("%s %s", name, err)
+			if pe, ok := err.(parseError); ok {
+				msg = pe.translate(name, lang, english)
+			}
+			fields = append(fields, FieldError{
+				Field: name,
+				Error: msg,
+			})
+		}
+	}
+
+	if fields != nil {
+		return &Error{
+			Err:    errors.New("field validation error"),
+			Status: http.StatusBadRequest,
+			Code:   "validation_failed",
+			Fields: fields,
+		}
+	}
+
+	return nil
+}
+
+// parseError is returned when a value cannot be parsed into its field. It is
+// the key of the message, in paramMessages, describing what was expected.
+type parseError string
+
+// Parse errors for each kind of value.
+const (
+	errNotTime     parseError = "param_time"
+	errNotValid    parseError = "param_valid"
+	errNotDuration parseError = "param_duration"
+	errNotBool     parseError = "param_bool"
+	errNotInt      parseError = "param_int"
+	errNotUint     parseError = "param_uint"
+	errNotNumber   parseError = "param_number"
+)
+
+// Error implements the error interface. It gives the English message.
+func (e parseError) Error() string {
+	english, _ := translator.GetTranslator("en")
+	return e.translate("value", english, english)
+}
+
+// translate returns the message for e about the field name in lang, or in
+// fallback when lang has no message for it.
+func (e parseError) translate(name string, lang, fallback ut.Translator) string {
+	if msg, err := lang.T(string(e), name); err == nil {
+		return msg
+	}
+	msg, _ := fallback.T(string(e), name)
+	return msg
+}
+
+// textUnmarshaler matches encoding.TextUnmarshaler. It lets types such as
+// time.Time parse their own values.
+type textUnmarshaler interface {
+	UnmarshalText(text []byte) error
+}
+
+// textUnmarshalerType is the reflect.Type of textUnmarshaler.
+var textUnmarshalerType = reflect.TypeOf((*textUnmarshaler)(nil)).Elem()
+
+// setField parses values into f. Only slices use more than the first value.
+// The returned error describes what was expected.
+func setField(f reflect.Value, values []string) error {
+	if f.Kind() == reflect.Slice && !f.Type().Implements(textUnmarshalerType) {
+		s := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+		return nil
+	}
+
+	return setValue(f, values[0])
+}
+
+// setValue parses a single value into f.
+func setValue(f reflect.Value, value string) error {
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		if err := setValue(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	if f.CanAddr() && f.Addr().Type().Implements(textUnmarshalerType) {
+		u := f.Addr().Interface().(textUnmarshaler)
+		if err := u.UnmarshalText([]byte(value)); err != nil {
+			if _, ok := u.(*time.Time); ok {
+				return errNotTime
+			}
+			return errNotValid
+		}
+		return nil
+	}
+
+	if f.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errNotDuration
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errNotBool
+		}
+		f.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return errNotInt
+		}
+		f.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return errNotUint
+		}
+		f.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return errNotNumber
+		}
+		f.SetFloat(n)
+
+	default:
+		return fmt.Errorf("has unsupported type %v", f.Type())
+	}
+
+	return nil
+}
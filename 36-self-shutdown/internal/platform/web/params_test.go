@@ -0,0 +1,143 @@
+package web
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeParams(t *testing.T) {
+	var params struct {
+		ID string `path:"id" validate:"uuid"`
+	}
+
+	tests := []struct {
+		id     string
+		fields []FieldError
+	}{
+		{"a2b0639f-2cc6-44b8-b97b-15d69dbb511e", nil},
+		{"not-a-uuid", []FieldError{{Field: "id", Error: "id must be a valid UUID"}}},
+	}
+
+	for _, tt := range tests {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", tt.id)
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+		err := DecodeParams(r, &params)
+		if tt.fields == nil {
+			if err != nil {
+				t.Fatalf("%q: decoding: %s", tt.id, err)
+			}
+			if params.ID != tt.id {
+				t.Fatalf("%q: expected ID to be bound, got %q", tt.id, params.ID)
+			}
+			continue
+		}
+
+		webErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("%q: expected a *web.Error, got %v", tt.id, err)
+		}
+		if diff := cmp.Diff(tt.fields, webErr.Fields); diff != "" {
+			t.Fatalf("%q: fields did not match expected. Diff:\n%s", tt.id, diff)
+		}
+	}
+}
+
+func TestDecodeQuery(t *testing.T) {
+	type query struct {
+		Name   string     `query:"name"`
+		Limit  int        `query:"limit" validate:"gte=1,lte=100"`
+		Active *bool      `query:"active"`
+		After  time.Time  `query:"after"`
+		Tags   []string   `query:"tag"`
+		Costs  []int      `query:"cost"`
+		Ignore string     `query:"-"`
+		Since  *time.Time `query:"since"`
+	}
+
+	{ // Valid values are bound and missing ones keep their defaults.
+		q := query{Limit: 50}
+		r := httptest.NewRequest("GET", "/?name=comic&active=true&after=2019-01-01T00:00:00Z&tag=a&tag=b&cost=1&cost=2&-=x", nil)
+
+		if err := DecodeQuery(r, &q); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+
+		active := true
+		want := query{
+			Name:   "comic",
+			Limit:  50,
+			Active: &active,
+			After:  time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+			Tags:   []string{"a", "b"},
+			Costs:  []int{1, 2},
+		}
+		if diff := cmp.Diff(want, q); diff != "" {
+			t.Fatalf("bound values did not match expected. Diff:\n%s", diff)
+		}
+	}
+
+	{ // Values of the wrong type are all reported.
+		var q query
+		r := httptest.NewRequest("GET", "/?limit=ten&active=maybe&after=yesterday", nil)
+
+		err := DecodeQuery(r, &q)
+		webErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("expected a *web.Error, got %v", err)
+		}
+
+		want := []FieldError{
+			{Field: "limit", Error: "limit must be an integer"},
+			{Field: "active", Error: "active must be true or false"},
+			{Field: "after", Error: "after must be an RFC 3339 time"},
+		}
+		if diff := cmp.Diff(want, webErr.Fields); diff != "" {
+			t.Fatalf("fields did not match expected. Diff:\n%s", diff)
+		}
+	}
+
+	{ // Parse errors are in the client's language.
+		var q query
+		r := httptest.NewRequest("GET", "/?limit=ten&after=yesterday", nil)
+		r.Header.Set("Accept-Language", "de-DE, fr;q=0.5")
+
+		err := DecodeQuery(r, &q)
+		webErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("expected a *web.Error, got %v", err)
+		}
+
+		want := []FieldError{
+			{Field: "limit", Error: "limit muss eine ganze Zahl sein"},
+			{Field: "after", Error: "after muss eine RFC-3339-Zeitangabe sein"},
+		}
+		if diff := cmp.Diff(want, webErr.Fields); diff != "" {
+			t.Fatalf("fields did not match expected. Diff:\n%s", diff)
+		}
+	}
+
+	{ // Parsed values are validated.
+		q := query{Limit: 50}
+		r := httptest.NewRequest("GET", "/?limit=500", nil)
+
+		err := DecodeQuery(r, &q)
+		webErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("expected a *web.Error, got %v", err)
+		}
+
+		want := []FieldError{{Field: "limit", Error: "limit must be 100 or less"}}
+		if diff := cmp.Diff(want, webErr.Fields); diff != "" {
+			t.Fatalf("fields did not match expected. Diff:\n%s", diff)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package web
+
+// Problem is the form used for API responses from failures when the client
+// accepts application/problem+json as described in RFC 7807. Code and Fields
+// are extension members.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Code     string       `json:"code"`
+	Instance string       `json:"instance,omitempty"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+// problemEncoding is used for error responses when the client opts in to
+// RFC 7807 problem details.
+var problemEncoding = encoding{
+	mediaType:   "application/problem+json",
+	contentType: "application/problem+json; charset=utf-8",
+	encode:      EncodeJSON,
+}
+
+// wantsProblem reports whether an Accept header opts in to problem details.
+// The client must name application/problem+json explicitly, since wildcards
+// are always satisfied by plain JSON, and must not prefer application/json.
+func wantsProblem(accept string) bool {
+	var problemQ, jsonQ float64
+	jsonSpecific := -1
+
+	for _, mr := range parseAccept(accept) {
+		if mr.match(problemEncoding.mediaType) == 2 {
+			problemQ = mr.q
+		}
+		if m := mr.match(jsonEncoding.mediaType); m > jsonSpecific {
+			jsonSpecific, jsonQ = m, mr.q
+		}
+	}
+
+	return problemQ > 0 && problemQ >= jsonQ
+}
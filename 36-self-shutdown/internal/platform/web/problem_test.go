@@ -0,0 +1,103 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWantsProblem(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/problem+json", true},
+		{"application/json, application/problem+json", true},
+		{"application/problem+json;q=0.5, application/json", false},
+		{"application/problem+json;q=0", false},
+		{"application/problem+json, */*;q=0.1", true},
+	}
+
+	for _, tt := range tests {
+		if got := wantsProblem(tt.accept); got != tt.want {
+			t.Fatalf("%q: expected %v, got %v", tt.accept, tt.want, got)
+		}
+	}
+}
+
+func TestRespondErrorProblem(t *testing.T) {
+	v := Values{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		Accept:  "application/problem+json",
+	}
+	ctx := context.WithValue(context.Background(), KeyValues, &v)
+
+	err := &Error{
+		Err:    errors.New("field validation error"),
+		Status: http.StatusBadRequest,
+		Fields: []FieldError{{Field: "name", Error: "name is a required field"}},
+	}
+
+	resp := httptest.NewRecorder()
+	if err := RespondError(ctx, resp, err); err != nil {
+		t.Fatalf("responding: %s", err)
+	}
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %v, got %v", http.StatusBadRequest, resp.Code)
+	}
+	if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/problem+json") {
+		t.Fatalf("expected problem content type, got %q", ct)
+	}
+
+	var got Problem
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+
+	want := Problem{
+		Type:     "about:blank",
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   "field validation error",
+		Code:     "bad_request",
+		Instance: v.TraceID,
+		Fields:   err.Fields,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Response did not match expected. Diff:\n%s", diff)
+	}
+}
+
+func TestRespondProblemOnly(t *testing.T) {
+	v := Values{Accept: "application/problem+json"}
+	ctx := context.WithValue(context.Background(), KeyValues, &v)
+
+	// Clients which only ask for problem details still get successful
+	// responses, as plain JSON.
+	resp := httptest.NewRecorder()
+	if err := Respond(ctx, resp, map[string]int{"n": 1}, http.StatusOK); err != nil {
+		t.Fatalf("responding: %s", err)
+	}
+	if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("expected JSON content type, got %q", ct)
+	}
+
+	resp = httptest.NewRecorder()
+	s := sliceStream{values: []interface{}{1, 2}}
+	if err := RespondStream(ctx, resp, &s, http.StatusOK); err != nil {
+		t.Fatalf("streaming: %s", err)
+	}
+	if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("expected JSON content type streaming, got %q", ct)
+	}
+}
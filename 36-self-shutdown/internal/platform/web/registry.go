@@ -0,0 +1,104 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// registered is the web specific context for a sentinel error.
+type registered struct {
+	status int
+	code   string
+}
+
+// registry maps sentinel errors from other packages to the response sent
+// when a handler returns them.
+var registry struct {
+	sync.RWMutex
+	errs map[error]registered
+}
+
+// RegisterError associates a sentinel error with an HTTP status and a stable
+// machine readable code. When a handler returns err, or an error which wraps
+// it, RespondError answers with that status and code. It is intended to be
+// called from the init function of the package which defines err.
+func RegisterError(err error, status int, code string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.errs == nil {
+		registry.errs = make(map[error]registered)
+	}
+	registry.errs[err] = registered{status: status, code: code}
+}
+
+// lookup returns the registration for the first registered error in the
+// chain of err.
+func lookup(err error) (registered, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var (
+		reg   registered
+		found bool
+	)
+	walk(err, func(err error) bool {
+		reg, found = registry.errs[err]
+		return found
+	})
+
+	return reg, found
+}
+
+// resolve turns any error returned by a handler into the *Error used to
+// respond to the client. The outermost *Error or registered error in the
+// chain wins. Anything else is an unexpected 500.
+func resolve(err error) *Error {
+	var webErr *Error
+	walk(err, func(err error) bool {
+		if e, ok := err.(*Error); ok {
+			webErr = e
+			return true
+		}
+
+		// Only match err itself here, not what it wraps, so an *Error further
+		// down the chain is not skipped.
+		registry.RLock()
+		reg, ok := registry.errs[err]
+		registry.RUnlock()
+		if ok {
+			webErr = &Error{Err: err, Status: reg.status, Code: reg.code}
+		}
+		return ok
+	})
+
+	if webErr == nil {
+		webErr = &Error{
+			Err:    errors.New(http.StatusText(http.StatusInternalServerError)),
+			Status: http.StatusInternalServerError,
+		}
+	}
+
+	// Fill in a missing code from a registered error wrapped by the *Error or,
+	// failing that, from the status.
+	if webErr.Code == "" {
+		e := *webErr
+		if reg, ok := lookup(e.Err); ok {
+			e.Code = reg.code
+		} else {
+			e.Code = statusCode(e.Status)
+		}
+		webErr = &e
+	}
+
+	return webErr
+}
+
+// statusCode derives a code from an HTTP status, such as "not_found" for 404.
+func statusCode(status int) string {
+	text := strings.ToLower(http.StatusText(status))
+	return strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text)
+}
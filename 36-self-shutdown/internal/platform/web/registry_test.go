@@ -0,0 +1,77 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestRespondErrorRegistry(t *testing.T) {
+	errGone := errors.New("widget is gone")
+	RegisterError(errGone, http.StatusGone, "widget_gone")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		want   ErrorResponse
+	}{
+		{
+			name:   "registered",
+			err:    errGone,
+			status: http.StatusGone,
+			want:   ErrorResponse{Error: "widget is gone", Code: "widget_gone"},
+		},
+		{
+			name:   "wrapped registered",
+			err:    errors.Wrapf(errors.Wrap(errGone, "loading"), "widget %q", "abc"),
+			status: http.StatusGone,
+			want:   ErrorResponse{Error: "widget is gone", Code: "widget_gone"},
+		},
+		{
+			name:   "request error wrapping registered",
+			err:    NewRequestError(errGone, http.StatusNotFound),
+			status: http.StatusNotFound,
+			want:   ErrorResponse{Error: "widget is gone", Code: "widget_gone"},
+		},
+		{
+			name:   "request error",
+			err:    errors.Wrap(NewRequestError(errors.New("no"), http.StatusConflict), "saving"),
+			status: http.StatusConflict,
+			want:   ErrorResponse{Error: "no", Code: "conflict"},
+		},
+		{
+			name:   "unexpected",
+			err:    errors.New("database exploded"),
+			status: http.StatusInternalServerError,
+			want:   ErrorResponse{Error: "Internal Server Error", Code: "internal_server_error"},
+		},
+	}
+
+	for _, tt := range tests {
+		v := Values{}
+		ctx := context.WithValue(context.Background(), KeyValues, &v)
+		resp := httptest.NewRecorder()
+
+		if err := RespondError(ctx, resp, tt.err); err != nil {
+			t.Fatalf("%s: responding: %s", tt.name, err)
+		}
+
+		if resp.Code != tt.status {
+			t.Fatalf("%s: expected status code %v, got %v", tt.name, tt.status, resp.Code)
+		}
+
+		var got ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: decoding: %s", tt.name, err)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Fatalf("%s: Response did not match expected. Diff:\n%s", tt.name, diff)
+		}
+	}
+}
@@ -3,14 +3,22 @@ package web
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
+	de "github.com/go-playground/locales/de"
 	en "github.com/go-playground/locales/en"
+	es "github.com/go-playground/locales/es"
+	fr "github.com/go-playground/locales/fr"
 	ut "github.com/go-playground/universal-translator"
 	validator "gopkg.in/go-playground/validator.v9"
 	en_translations "gopkg.in/go-playground/validator.v9/translations/en"
+	fr_translations "gopkg.in/go-playground/validator.v9/translations/fr"
 )
 
 // validate holds the settings and caches for validating request struct values.
@@ -21,38 +29,123 @@ var translator *ut.UniversalTranslator
 
 func init() {
 
-	// Instantiate the english locale for the validator library.
+	// Instantiate the locales supported for validation error messages.
 	enLocale := en.New()
 
 	// Create a value using English as the fallback locale (first argument).
 	// Provide one or more arguments for additional supported locales.
-	translator = ut.New(enLocale, enLocale)
+	translator = ut.New(enLocale, enLocale, es.New(), fr.New(), de.New())
 
-	// Register the english error messages for validation errors.
+	// Register the error messages for validation errors. The validator
+	// library provides English and French. Spanish and German come from the
+	// messages in this package.
 	lang, _ := translator.GetTranslator("en")
 	en_translations.RegisterDefaultTranslations(validate, lang)
 
-	// Use JSON tag names for errors instead of Go struct names.
+	lang, _ = translator.GetTranslator("fr")
+	fr_translations.RegisterDefaultTranslations(validate, lang)
+
+	for locale, msgs := range messages {
+		lang, _ := translator.GetTranslator(locale)
+		if err := registerMessages(validate, lang, msgs); err != nil {
+			panic(err)
+		}
+	}
+
+	// Path and query values which cannot be parsed share the translators.
+	for locale, msgs := range paramMessages {
+		lang, _ := translator.GetTranslator(locale)
+		for key, msg := range msgs {
+			if err := lang.Add(key, msg, false); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	// Some fields use an empty string to clear a reference, so they accept
+	// either nothing or a UUID.
+	validate.RegisterValidation("uuid_or_empty", func(fl validator.FieldLevel) bool {
+		s := fl.Field().String()
+		return s == "" || validate.Var(s, "uuid") == nil
+	})
+
+	// Use JSON, query or path tag names for errors instead of Go struct names.
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
-		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
-		if name == "-" {
-			return ""
+		for _, key := range []string{"json", "query", "path"} {
+			name := strings.SplitN(fld.Tag.Get(key), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
 		}
-		return name
+		return ""
 	})
 }
 
+// RegisterValidation adds a validation tag which accepts a string field when
+// valid returns true. msgs holds the error message for the tag keyed by
+// locale, such as "en", and may reference the field name as {0}. Locales
+// without a message use the English one. It is intended to be called from
+// the init function of the package which defines the rule.
+func RegisterValidation(tag string, valid func(s string) bool, msgs map[string]string) {
+	err := validate.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+		return valid(fl.Field().String())
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	for locale, msg := range msgs {
+		lang, ok := translator.GetTranslator(locale)
+		if !ok {
+			panic(fmt.Sprintf("web: no translator for locale %q", locale))
+		}
+		if err := registerMessages(validate, lang, map[string]string{tag: msg}); err != nil {
+			panic(err)
+		}
+	}
+}
+
 // Decode reads the body of an HTTP request looking for a JSON document. The
-// body is decoded into the provided value.
+// body is decoded into the provided value. The body must hold exactly one
+// document with no unknown fields. Malformed documents are reported as a 400
+// with a FieldError naming the field, or the byte offset, at fault. Bodies
+// over the limit set by LimitBody get a 413.
 //
 // If the provided value is a struct then it is checked for validation tags.
 func Decode(r *http.Request, val interface{}) error {
-	decoder := json.NewDecoder(r.Body)
+	body := countingReader{r: r.Body}
+	decoder := json.NewDecoder(&body)
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(val); err != nil {
-		return NewRequestError(err, http.StatusBadRequest)
+		return decodeError(err)
 	}
 
+	// The document ends at what was read less what the decoder has buffered.
+	end := body.n
+	if b, ok := decoder.Buffered().(interface{ Len() int }); ok {
+		end -= int64(b.Len())
+	}
+
+	// Anything but whitespace after the document is an error.
+	if _, err := decoder.Token(); err != io.EOF {
+		if _, ok := err.(*bodyTooLarge); ok {
+			return decodeError(err)
+		}
+		return badJSON(FieldError{
+			Offset: end,
+			Error:  "body must only contain a single JSON document",
+		})
+	}
+
+	return check(r, val)
+}
+
+// check validates val against its validation tags. Any failures are returned
+// as a 400 *Error with a FieldError, in the client's language, per field.
+func check(r *http.Request, val interface{}) error {
 	if err := validate.Struct(val); err != nil {
 
 		// Use a type assertion to get the real error value.
@@ -61,15 +154,16 @@ func Decode(r *http.Request, val interface{}) error {
 			return err
 		}
 
-		// lang controls the language of the error messages. You could look at the
-		// Accept-Language header if you intend to support multiple languages.
-		lang, _ := translator.GetTranslator("en")
+		// lang controls the language of the error messages. It is chosen from
+		// the Accept-Language header, falling back to English.
+		lang := findTranslator(r.Header.Get("Accept-Language"))
+		english, _ := translator.GetTranslator("en")
 
 		var fields []FieldError
 		for _, verror := range verrors {
 			field := FieldError{
 				Field: verror.Field(),
-				Error: verror.Translate(lang),
+				Error: translate(verror, lang, english),
 			}
 			fields = append(fields, field)
 		}
@@ -77,9 +171,161 @@ func Decode(r *http.Request, val interface{}) error {
 		return &Error{
 			Err:    errors.New("field validation error"),
 			Status: http.StatusBadRequest,
+			Code:   "validation_failed",
 			Fields: fields,
 		}
 	}
 
 	return nil
 }
+
+// decodeError converts an error from decoding a JSON document into a
+// response clients can act on.
+func decodeError(err error) error {
+	switch e := err.(type) {
+	case *bodyTooLarge:
+		return &Error{
+			Err:    e,
+			Status: http.StatusRequestEntityTooLarge,
+		}
+
+	case *json.SyntaxError:
+		return badJSON(FieldError{
+			Offset: e.Offset,
+			Error:  "body contains malformed JSON: " + e.Error(),
+		})
+
+	case *json.UnmarshalTypeError:
+		fe := FieldError{
+			Field:  e.Field,
+			Offset: e.Offset,
+			Error:  fmt.Sprintf("must be %s", jsonType(e.Type)),
+		}
+		if fe.Field != "" {
+			fe.Error = fe.Field + " " + fe.Error
+			fe.Offset = 0
+		}
+		return badJSON(fe)
+	}
+
+	switch {
+	case err == io.EOF:
+		return badJSON(FieldError{Error: "body must not be empty"})
+
+	case err == io.ErrUnexpectedEOF:
+		return badJSON(FieldError{Error: "body contains malformed JSON: unexpected end of input"})
+
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		name := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return badJSON(FieldError{Field: name, Error: name + " is not a known field"})
+	}
+
+	return NewRequestError(err, http.StatusBadRequest)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements the io.Reader interface.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// badJSON wraps a FieldError describing a malformed body in a 400 *Error.
+func badJSON(fe FieldError) error {
+	return &Error{
+		Err:    errors.New("malformed request body"),
+		Status: http.StatusBadRequest,
+		Code:   "malformed_body",
+		Fields: []FieldError{fe},
+	}
+}
+
+// jsonType describes a Go type as the JSON type a client should have sent.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a positive integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+	return "a " + t.String()
+}
+
+// translate returns the message for verror in lang. A locale may not have a
+// message for every tag, in which case the validator returns its untranslated
+// error text, so the fallback translator is used instead.
+func translate(verror validator.FieldError, lang, fallback ut.Translator) string {
+	msg := verror.Translate(lang)
+	if e, ok := verror.(error); ok && msg == e.Error() {
+		msg = verror.Translate(fallback)
+	}
+	return msg
+}
+
+// findTranslator picks the translator for the most preferred language in an
+// Accept-Language header that has one. A regional tag like es-MX also matches
+// the base language. English is used when nothing matches.
+func findTranslator(acceptLanguage string) ut.Translator {
+	type language struct {
+		tag string
+		q   float64
+	}
+
+	var langs []language
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+
+		l := language{tag: strings.TrimSpace(fields[0]), q: 1}
+		if l.tag == "" || l.tag == "*" {
+			continue
+		}
+
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				l.q = q
+			}
+		}
+
+		if l.q > 0 {
+			langs = append(langs, l)
+		}
+	}
+
+	// Keep the client's order for languages of equal preference.
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	var locales []string
+	for _, l := range langs {
+		locale := strings.Replace(l.tag, "-", "_", -1)
+		locales = append(locales, locale)
+		if i := strings.Index(locale, "_"); i > 0 {
+			locales = append(locales, locale[:i])
+		}
+	}
+
+	lang, _ := translator.FindTranslator(locales...)
+	return lang
+}
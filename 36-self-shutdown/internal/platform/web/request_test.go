@@ -1,9 +1,12 @@
 package web
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestDecode(t *testing.T) {
@@ -23,3 +26,223 @@ func TestDecode(t *testing.T) {
 
 	t.Log(err)
 }
+
+func TestDecodeLocalized(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           []FieldError
+	}{
+		{"", []FieldError{
+			{Field: "name", Error: "name is a required field"},
+			{Field: "site", Error: "site must be a valid URL"},
+		}},
+		{"es", []FieldError{
+			{Field: "name", Error: "name es un campo requerido"},
+			{Field: "site", Error: "site must be a valid URL"},
+		}},
+		{"es-MX,en;q=0.5", []FieldError{
+			{Field: "name", Error: "name es un campo requerido"},
+			{Field: "site", Error: "site must be a valid URL"},
+		}},
+		{"ja, de;q=0.8, fr;q=0.9", []FieldError{
+			{Field: "name", Error: "name est un champ obligatoire"},
+			{Field: "site", Error: "site doit être une URL valide"},
+		}},
+		{"de-CH", []FieldError{
+			{Field: "name", Error: "name ist ein Pflichtfeld"},
+			{Field: "site", Error: "site must be a valid URL"},
+		}},
+		{"ja", []FieldError{
+			{Field: "name", Error: "name is a required field"},
+			{Field: "site", Error: "site must be a valid URL"},
+		}},
+	}
+
+	for _, tt := range tests {
+		var u struct {
+			Name string `json:"name" validate:"required"`
+			Site string `json:"site" validate:"url"`
+		}
+
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"site":"nope"}`))
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+
+		err := Decode(r, &u)
+
+		webErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("%q: expected a *web.Error, got %v", tt.acceptLanguage, err)
+		}
+		if diff := cmp.Diff(tt.want, webErr.Fields); diff != "" {
+			t.Fatalf("%q: fields did not match expected. Diff:\n%s", tt.acceptLanguage, diff)
+		}
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	RegisterValidation("test_even", func(s string) bool {
+		return len(s)%2 == 0
+	}, map[string]string{
+		"en": "{0} must have an even length",
+		"de": "{0} muss eine gerade Länge haben",
+	})
+
+	tests := []struct {
+		body           string
+		acceptLanguage string
+		want           []FieldError
+	}{
+		{`{"code":"ab"}`, "", nil},
+		{`{"code":"abc"}`, "", []FieldError{
+			{Field: "code", Error: "code must have an even length"},
+		}},
+		{`{"code":"abc"}`, "de", []FieldError{
+			{Field: "code", Error: "code muss eine gerade Länge haben"},
+		}},
+		{`{"code":"abc"}`, "fr", []FieldError{
+			{Field: "code", Error: "code must have an even length"},
+		}},
+	}
+
+	for _, tt := range tests {
+		var v struct {
+			Code string `json:"code" validate:"test_even"`
+		}
+
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+		err := Decode(r, &v)
+
+		var fields []FieldError
+		if webErr, ok := err.(*Error); ok {
+			fields = webErr.Fields
+		} else if err != nil {
+			t.Fatalf("%s: expected a *web.Error, got %v", tt.body, err)
+		}
+		if diff := cmp.Diff(tt.want, fields); diff != "" {
+			t.Fatalf("%s: fields did not match expected. Diff:\n%s", tt.body, diff)
+		}
+	}
+}
+
+func TestDecodeUUIDOrEmpty(t *testing.T) {
+	tests := []struct {
+		body string
+		want []FieldError
+	}{
+		{`{"parent_id":""}`, nil},
+		{`{"parent_id":"f3a1b2c4-5d6e-4f70-8a9b-0c1d2e3f4a5b"}`, nil},
+		{`{"parent_id":"top"}`, []FieldError{
+			{Field: "parent_id", Error: "parent_id must be a valid UUID or empty"},
+		}},
+	}
+
+	for _, tt := range tests {
+		var v struct {
+			ParentID *string `json:"parent_id" validate:"omitempty,uuid_or_empty"`
+		}
+
+		err := Decode(httptest.NewRequest("POST", "/", strings.NewReader(tt.body)), &v)
+
+		var fields []FieldError
+		if webErr, ok := err.(*Error); ok {
+			fields = webErr.Fields
+		} else if err != nil {
+			t.Fatalf("%s: expected a *web.Error, got %v", tt.body, err)
+		}
+		if diff := cmp.Diff(tt.want, fields); diff != "" {
+			t.Fatalf("%s: fields did not match expected. Diff:\n%s", tt.body, diff)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	type product struct {
+		Name string `json:"name"`
+		Cost int    `json:"cost"`
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		limit  int64
+		status int
+		fields []FieldError
+	}{
+		{
+			name:   "valid",
+			body:   `{"name":"Comic Books","cost":50}  ` + "\n",
+			status: 0,
+		},
+		{
+			name:   "trailing data",
+			body:   `{"name":"Comic Books"}{"name":"Toys"}`,
+			status: http.StatusBadRequest,
+			fields: []FieldError{{Offset: 22, Error: "body must only contain a single JSON document"}},
+		},
+		{
+			name:   "syntax",
+			body:   `{"name":"Comic Books",}`,
+			status: http.StatusBadRequest,
+			fields: []FieldError{{Offset: 23, Error: "body contains malformed JSON: invalid character '}' looking for beginning of object key string"}},
+		},
+		{
+			name:   "type",
+			body:   `{"name":"Comic Books","cost":"fifty"}`,
+			status: http.StatusBadRequest,
+			fields: []FieldError{{Field: "cost", Error: "cost must be an integer"}},
+		},
+		{
+			name:   "unknown field",
+			body:   `{"title":"Comic Books"}`,
+			status: http.StatusBadRequest,
+			fields: []FieldError{{Field: "title", Error: "title is not a known field"}},
+		},
+		{
+			name:   "empty",
+			body:   ``,
+			status: http.StatusBadRequest,
+			fields: []FieldError{{Error: "body must not be empty"}},
+		},
+		{
+			name:   "too large",
+			body:   `{"name":"Comic Books","cost":50}`,
+			limit:  10,
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "exactly the limit",
+			body:   `{"cost":50}`,
+			limit:  11,
+			status: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		if tt.limit > 0 {
+			LimitBody(r, tt.limit)
+		}
+
+		var p product
+		err := Decode(r, &p)
+
+		if tt.status == 0 {
+			if err != nil {
+				t.Fatalf("%s: decoding: %s", tt.name, err)
+			}
+			continue
+		}
+
+		webErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("%s: expected a *web.Error, got %v", tt.name, err)
+		}
+		if webErr.Status != tt.status {
+			t.Fatalf("%s: expected status %v, got %v", tt.name, tt.status, webErr.Status)
+		}
+		if diff := cmp.Diff(tt.fields, webErr.Fields); diff != "" {
+			t.Fatalf("%s: fields did not match expected. Diff:\n%s", tt.name, diff)
+		}
+	}
+}
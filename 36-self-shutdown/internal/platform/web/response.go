@@ -1,15 +1,31 @@
 package web
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"net/http"
-
-	"github.com/pkg/errors"
+	"strings"
 )
 
-// Respond converts a Go value to JSON and sends it to the client.
+// Respond converts a Go value to the media type requested in the Accept
+// header and sends it to the client. JSON is used when the client has no
+// preference. If no registered Encoder is acceptable a 406 error is returned.
 func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int) error {
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("web value missing from context")
+	}
+
+	enc, ok := negotiate(v.Accept, false)
+	if !ok && statusCode != http.StatusNoContent {
+		return NewRequestError(ErrNotAcceptable, http.StatusNotAcceptable)
+	}
+
+	return respond(ctx, w, data, statusCode, enc)
+}
+
+// respond encodes data with a specific encoding and sends it to the client.
+func respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int, enc encoding) error {
 
 	// Set the status code for the request logger middleware.
 	// If the context is missing this value, request the service
@@ -20,49 +36,90 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	}
 	v.StatusCode = statusCode
 
+	// The body depends on the Accept header so caches must key on it.
+	addVary(w.Header(), "Accept")
+
 	if statusCode == http.StatusNoContent {
 		w.WriteHeader(statusCode)
 		return nil
 	}
 
-	// Convert the response value to JSON.
-	res, err := json.Marshal(data)
-	if err != nil {
+	// Encode the whole response before writing anything so an encoding error
+	// can still be reported to the client.
+	var buf bytes.Buffer
+	if err := enc.encode(&buf, data); err != nil {
 		return err
 	}
 
-	// Respond with the provided JSON.
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	// Respond with the encoded document.
+	w.Header().Set("Content-Type", enc.contentType)
 	w.WriteHeader(statusCode)
-	if _, err := w.Write(res); err != nil {
+	if _, err := buf.WriteTo(w); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// RespondError sends an error reponse back to the client.
+// jsonEncoding is used for error responses regardless of the Accept header.
+// Error bodies are not tabular so they are always sent as JSON.
+var jsonEncoding = encoding{
+	mediaType:   "application/json",
+	contentType: "application/json; charset=utf-8",
+	encode:      EncodeJSON,
+}
+
+// RespondError sends an error reponse back to the client. The body is an
+// ErrorResponse unless the client accepts application/problem+json, in which
+// case it is a Problem.
 func RespondError(ctx context.Context, w http.ResponseWriter, err error) error {
 
-	// If the error was of the type *Error, the handler has
-	// a specific status code and error to return.
-	if webErr, ok := errors.Cause(err).(*Error); ok {
-		er := ErrorResponse{
-			Error:  webErr.Err.Error(),
-			Fields: webErr.Fields,
+	// A streamed response which failed part way through has already sent its
+	// status code and signaled the failure. There is nothing left to send.
+	if isStreamError(err) {
+		return nil
+	}
+
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("web value missing from context")
+	}
+
+	// Find the status code and error to return. This is either an *Error from
+	// the handler, a registered error or, for any arbitrary error, a 500.
+	webErr := resolve(err)
+
+	if wantsProblem(v.Accept) {
+		p := Problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(webErr.Status),
+			Status:   webErr.Status,
+			Code:     webErr.Code,
+			Instance: v.TraceID,
+			Fields:   webErr.Fields,
 		}
-		if err := Respond(ctx, w, er, webErr.Status); err != nil {
-			return err
+		if detail := webErr.Err.Error(); detail != p.Title {
+			p.Detail = detail
 		}
-		return nil
+		return respond(ctx, w, p, webErr.Status, problemEncoding)
 	}
 
-	// If not, the handler sent any arbitrary error value so use 500.
 	er := ErrorResponse{
-		Error: http.StatusText(http.StatusInternalServerError),
+		Error:  webErr.Err.Error(),
+		Code:   webErr.Code,
+		Fields: webErr.Fields,
 	}
-	if err := Respond(ctx, w, er, http.StatusInternalServerError); err != nil {
-		return err
+	return respond(ctx, w, er, webErr.Status, jsonEncoding)
+}
+
+// addVary adds field to the Vary header unless it is already listed.
+func addVary(h http.Header, field string) {
+	for _, v := range h["Vary"] {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return
+			}
+		}
 	}
-	return nil
+	h.Add("Vary", field)
 }
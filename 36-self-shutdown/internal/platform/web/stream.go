@@ -0,0 +1,112 @@
+package web
+
+import (
+	"context"
+	"net/http"
+)
+
+// Stream is a sequence of values sent to the client one at a time by
+// RespondStream. Its methods mirror *sql.Rows so a database cursor can be
+// adapted to it with little code.
+type Stream interface {
+
+	// Next prepares the next value. It returns false when the stream is
+	// exhausted or an error occurred, which is then reported by Err.
+	Next() bool
+
+	// Value returns the value prepared by Next.
+	Value() (interface{}, error)
+
+	// Err returns the error, if any, encountered during iteration.
+	Err() error
+
+	// Close releases any resources held by the stream.
+	Close() error
+}
+
+// TrailerStreamError is the HTTP trailer set when a streamed response fails
+// after the status code and part of the body were already sent.
+const TrailerStreamError = "X-Stream-Error"
+
+// RespondStream writes the values of s to the client as they are read, in the
+// media type requested in the Accept header. It always closes s.
+//
+// An error that happens before the first value is read is returned like any
+// other handler error. Once the status code is sent the only way left to
+// signal a failure is to stop writing: the document is left unterminated, the
+// X-Stream-Error trailer is set and an error is returned which RespondError
+// knows not to answer.
+func RespondStream(ctx context.Context, w http.ResponseWriter, s Stream, statusCode int) error {
+	defer s.Close()
+
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("web value missing from context")
+	}
+
+	enc, ok := negotiate(v.Accept, true)
+	if !ok {
+		return NewRequestError(ErrNotAcceptable, http.StatusNotAcceptable)
+	}
+
+	// Read the first value before anything is written. Until then a failure
+	// can still be reported with a proper status code.
+	val, more, err := next(s)
+	if err != nil {
+		return err
+	}
+
+	// Set the status code for the request logger middleware.
+	v.StatusCode = statusCode
+
+	addVary(w.Header(), "Accept")
+	w.Header().Set("Content-Type", enc.contentType)
+	w.Header().Set("Trailer", TrailerStreamError)
+	w.WriteHeader(statusCode)
+
+	vw := enc.stream(w)
+	for flushed := false; more; {
+		if err := vw.Write(val); err != nil {
+			return streamFailed(w, err)
+		}
+
+		// Push the first value out right away rather than waiting for the
+		// server's write buffer to fill.
+		if f, ok := w.(http.Flusher); ok && !flushed {
+			f.Flush()
+			flushed = true
+		}
+
+		if val, more, err = next(s); err != nil {
+			return streamFailed(w, err)
+		}
+	}
+
+	if err := vw.Close(); err != nil {
+		return streamFailed(w, err)
+	}
+
+	return nil
+}
+
+// next advances s and returns the value it prepared. It reports false once
+// the stream is exhausted.
+func next(s Stream) (interface{}, bool, error) {
+	if !s.Next() {
+		return nil, false, s.Err()
+	}
+
+	val, err := s.Value()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return val, true, nil
+}
+
+// streamFailed sets the error trailer and wraps err so it is not answered
+// again further up the call chain.
+func streamFailed(w http.ResponseWriter, err error) error {
+	w.Header().Set(TrailerStreamError, http.StatusText(http.StatusInternalServerError))
+	return &streamError{err}
+}
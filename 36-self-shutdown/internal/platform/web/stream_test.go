@@ -0,0 +1,120 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sliceStream is a Stream over a slice. If err is set it is returned by Value
+// once failAt values have been read.
+type sliceStream struct {
+	values []interface{}
+	i      int
+	failAt int
+	err    error
+	closed bool
+}
+
+func (s *sliceStream) Next() bool {
+	s.i++
+	return s.i <= len(s.values)
+}
+
+func (s *sliceStream) Value() (interface{}, error) {
+	if s.err != nil && s.i > s.failAt {
+		return nil, s.err
+	}
+	return s.values[s.i-1], nil
+}
+
+func (s *sliceStream) Err() error   { return nil }
+func (s *sliceStream) Close() error { s.closed = true; return nil }
+
+type item struct {
+	ID int `json:"id"`
+}
+
+func streamCtx(accept string) (context.Context, *Values) {
+	v := Values{Accept: accept}
+	return context.WithValue(context.Background(), KeyValues, &v), &v
+}
+
+func TestRespondStream(t *testing.T) {
+	tests := []struct {
+		accept string
+		values []interface{}
+		want   string
+	}{
+		{"application/json", []interface{}{item{1}, item{2}}, `[{"id":1},{"id":2}]`},
+		{"application/json", nil, `[]`},
+		{"application/x-ndjson", []interface{}{item{1}, &item{2}}, "{\"id\":1}\n{\"id\":2}\n"},
+		{"text/csv", []interface{}{item{1}, &item{2}}, "id\n1\n2\n"},
+	}
+
+	for _, tt := range tests {
+		ctx, v := streamCtx(tt.accept)
+		s := sliceStream{values: tt.values}
+		resp := httptest.NewRecorder()
+
+		if err := RespondStream(ctx, resp, &s, http.StatusOK); err != nil {
+			t.Fatalf("%s: responding: %s", tt.accept, err)
+		}
+
+		if got := resp.Body.String(); got != tt.want {
+			t.Fatalf("%s: expected body %q, got %q", tt.accept, tt.want, got)
+		}
+		if v.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected status code %v recorded, got %v", tt.accept, http.StatusOK, v.StatusCode)
+		}
+		if !s.closed {
+			t.Fatalf("%s: stream was not closed", tt.accept)
+		}
+	}
+}
+
+func TestRespondStreamFailures(t *testing.T) {
+	boom := errors.New("boom")
+
+	{ // Failing before anything is written is a normal error.
+		ctx, _ := streamCtx("")
+		s := sliceStream{values: []interface{}{item{1}}, err: boom}
+		resp := httptest.NewRecorder()
+
+		err := RespondStream(ctx, resp, &s, http.StatusOK)
+		if err != boom {
+			t.Fatalf("expected the stream error, got %v", err)
+		}
+		if resp.Body.Len() != 0 {
+			t.Fatalf("expected nothing written, got %q", resp.Body.String())
+		}
+	}
+
+	{ // Failing part way through leaves the document unterminated.
+		ctx, _ := streamCtx("")
+		s := sliceStream{values: []interface{}{item{1}, item{2}, item{3}}, failAt: 2, err: boom}
+		resp := httptest.NewRecorder()
+
+		err := RespondStream(ctx, resp, &s, http.StatusOK)
+		if !isStreamError(err) {
+			t.Fatalf("expected a stream error, got %v", err)
+		}
+
+		if got, want := resp.Body.String(), `[{"id":1},{"id":2}`; got != want {
+			t.Fatalf("expected body %q, got %q", want, got)
+		}
+		if resp.Result().Trailer.Get(TrailerStreamError) == "" {
+			t.Fatal("expected the stream error trailer to be set")
+		}
+
+		// The error has been signaled so RespondError must not write again.
+		if err := RespondError(ctx, resp, err); err != nil {
+			t.Fatalf("responding to error: %s", err)
+		}
+		if got, want := resp.Body.String(), `[{"id":1},{"id":2}`; got != want {
+			t.Fatalf("expected body %q after RespondError, got %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"fmt"
+
+	ut "github.com/go-playground/universal-translator"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// The validator library only ships translations for some locales. These
+// messages cover the common validation tags for the other locales we serve,
+// and our own tags for every locale. Tags missing here fall back to the
+// English message in Decode.
+var messages = map[string]map[string]string{
+	"en": {
+		"uuid_or_empty": "{0} must be a valid UUID or empty",
+	},
+	"fr": {
+		"uuid_or_empty": "{0} doit être un UUID valide ou vide",
+	},
+	"es": {
+		"required":      "{0} es un campo requerido",
+		"eqfield":       "{0} debe ser igual a {1}",
+		"gte":           "{0} debe ser {1} o mayor",
+		"lte":           "{0} debe ser {1} o menor",
+		"gt":            "{0} debe ser mayor que {1}",
+		"lt":            "{0} debe ser menor que {1}",
+		"min":           "{0} debe ser al menos {1}",
+		"max":           "{0} debe ser como máximo {1}",
+		"len":           "{0} debe tener una longitud de {1}",
+		"email":         "{0} debe ser una dirección de correo electrónico válida",
+		"uuid":          "{0} debe ser un UUID válido",
+		"oneof":         "{0} debe ser uno de [{1}]",
+		"uuid_or_empty": "{0} debe ser un UUID válido o estar vacío",
+	},
+	"de": {
+		"required":      "{0} ist ein Pflichtfeld",
+		"eqfield":       "{0} muss gleich {1} sein",
+		"gte":           "{0} muss {1} oder größer sein",
+		"lte":           "{0} muss {1} oder kleiner sein",
+		"gt":            "{0} muss größer als {1} sein",
+		"lt":            "{0} muss kleiner als {1} sein",
+		"min":           "{0} muss mindestens {1} sein",
+		"max":           "{0} darf höchstens {1} sein",
+		"len":           "{0} muss die Länge {1} haben",
+		"email":         "{0} muss eine gültige E-Mail-Adresse sein",
+		"uuid":          "{0} muss eine gültige UUID sein",
+		"oneof":         "{0} muss einer der Werte [{1}] sein",
+		"uuid_or_empty": "{0} muss eine gültige UUID oder leer sein",
+	},
+}
+
+// paramMessages describe path and query values which could not be parsed
+// into their field, for every locale we serve. The field name is {0}.
+var paramMessages = map[string]map[string]string{
+	"en": {
+		"param_time":     "{0} must be an RFC 3339 time",
+		"param_valid":    "{0} is not valid",
+		"param_duration": "{0} must be a duration",
+		"param_bool":     "{0} must be true or false",
+		"param_int":      "{0} must be an integer",
+		"param_uint":     "{0} must be a positive integer",
+		"param_number":   "{0} must be a number",
+	},
+	"fr": {
+		"param_time":     "{0} doit être une date RFC 3339",
+		"param_valid":    "{0} n'est pas valide",
+		"param_duration": "{0} doit être une durée",
+		"param_bool":     "{0} doit être true ou false",
+		"param_int":      "{0} doit être un entier",
+		"param_uint":     "{0} doit être un entier positif",
+		"param_number":   "{0} doit être un nombre",
+	},
+	"es": {
+		"param_time":     "{0} debe ser una fecha RFC 3339",
+		"param_valid":    "{0} no es válido",
+		"param_duration": "{0} debe ser una duración",
+		"param_bool":     "{0} debe ser true o false",
+		"param_int":      "{0} debe ser un número entero",
+		"param_uint":     "{0} debe ser un número entero positivo",
+		"param_number":   "{0} debe ser un número",
+	},
+	"de": {
+		"param_time":     "{0} muss eine RFC-3339-Zeitangabe sein",
+		"param_valid":    "{0} ist nicht gültig",
+		"param_duration": "{0} muss eine Dauer sein",
+		"param_bool":     "{0} muss true oder false sein",
+		"param_int":      "{0} muss eine ganze Zahl sein",
+		"param_uint":     "{0} muss eine positive ganze Zahl sein",
+		"param_number":   "{0} muss eine Zahl sein",
+	},
+}
+
+// registerMessages adds a set of simple messages for a locale to the
+// validator. Each message may reference the field name as {0} and the tag
+// parameter as {1}.
+func registerMessages(v *validator.Validate, trans ut.Translator, msgs map[string]string) error {
+	for tag, msg := range msgs {
+		msg := msg
+
+		register := func(trans ut.Translator) error {
+			return trans.Add(tag, msg, false)
+		}
+
+		translate := func(trans ut.Translator, fe validator.FieldError) string {
+			t, err := trans.T(fe.Tag(), fe.Field(), fe.Param())
+			if err != nil {
+				return fmt.Sprint(fe)
+			}
+			return t
+		}
+
+		if err := v.RegisterTranslation(tag, trans, register, translate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
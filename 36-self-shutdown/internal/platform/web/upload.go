@@ -0,0 +1,102 @@
+package web
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// File is a file uploaded in a multipart/form-data request body.
+type File struct {
+
+	// Name is the file name given by the client. It is only informative and
+	// must not be used as a path.
+	Name string
+
+	// Data holds the contents of the file.
+	Data []byte
+}
+
+// DecodeFile reads the file sent in the named field of a multipart/form-data
+// request body. Files larger than limit bytes are rejected with 413 Request
+// Entity Too Large. A limit of zero or less leaves the file size unrestricted,
+// though any limit on the whole body still applies. Other form fields are
+// skipped. The content type declared by the client is ignored so callers
+// should sniff Data instead.
+func DecodeFile(r *http.Request, field string, limit int64) (*File, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, &Error{
+			Err:    errors.New("request body must be multipart/form-data"),
+			Status: http.StatusUnsupportedMediaType,
+		}
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, &Error{
+				Err:    errors.New("field validation error"),
+				Status: http.StatusBadRequest,
+				Code:   "validation_failed",
+				Fields: []FieldError{{Field: field, Error: field + " is a required field"}},
+			}
+		}
+		if err != nil {
+			return nil, multipartError(r, err)
+		}
+
+		if part.FormName() != field || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		var src io.Reader = part
+		if limit > 0 {
+			src = io.LimitReader(part, limit+1)
+		}
+
+		data, err := ioutil.ReadAll(src)
+		if err != nil {
+			return nil, multipartError(r, err)
+		}
+
+		if limit > 0 && int64(len(data)) > limit {
+			return nil, &Error{
+				Err:    errors.Errorf("%s must not be larger than %d bytes", field, limit),
+				Status: http.StatusRequestEntityTooLarge,
+			}
+		}
+		if len(data) == 0 {
+			return nil, &Error{
+				Err:    errors.New("field validation error"),
+				Status: http.StatusBadRequest,
+				Code:   "validation_failed",
+				Fields: []FieldError{{Field: field, Error: field + " must not be empty"}},
+			}
+		}
+
+		return &File{Name: part.FileName(), Data: data}, nil
+	}
+}
+
+// multipartError converts an error from reading a multipart body into a
+// response clients can act on. The multipart reader wraps errors from the
+// body so a body over its limit is detected from the body itself.
+func multipartError(r *http.Request, err error) error {
+	if l, ok := r.Body.(*limitedBody); ok {
+		if tl, ok := l.err.(*bodyTooLarge); ok {
+			return decodeError(tl)
+		}
+	}
+
+	return &Error{
+		Err:    errors.New("malformed request body"),
+		Status: http.StatusBadRequest,
+		Code:   "malformed_body",
+		Fields: []FieldError{{Error: "body contains malformed multipart data: " + err.Error()}},
+	}
+}
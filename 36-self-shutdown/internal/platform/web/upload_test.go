@@ -0,0 +1,117 @@
+package web
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeFile(t *testing.T) {
+
+	// form builds a multipart body with a text field and, when data is not
+	// nil, a file in the image field.
+	form := func(data []byte) (string, *bytes.Buffer) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("caption", "Front cover")
+		if data != nil {
+			fw, _ := mw.CreateFormFile("image", "cover.png")
+			fw.Write(data)
+		}
+		mw.Close()
+		return mw.FormDataContentType(), &buf
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		limit       int64
+		bodyLimit   int64
+		status      int
+		fields      []FieldError
+	}{
+		{
+			name:  "valid",
+			data:  []byte("0123456789"),
+			limit: 10,
+		},
+		{
+			name:   "missing",
+			status: http.StatusBadRequest,
+			fields: []FieldError{{Field: "image", Error: "image is a required field"}},
+		},
+		{
+			name:   "empty",
+			data:   []byte{},
+			status: http.StatusBadRequest,
+			fields: []FieldError{{Field: "image", Error: "image must not be empty"}},
+		},
+		{
+			name:   "too large",
+			data:   []byte("0123456789"),
+			limit:  9,
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:      "body too large",
+			data:      []byte("0123456789"),
+			bodyLimit: 100,
+			status:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "not multipart",
+			contentType: "application/json",
+			status:      http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		contentType, body := form(tt.data)
+		if tt.contentType != "" {
+			contentType = tt.contentType
+		}
+
+		r := httptest.NewRequest("POST", "/", body)
+		r.Header.Set("Content-Type", contentType)
+		if tt.bodyLimit > 0 {
+			LimitBody(r, tt.bodyLimit)
+		}
+
+		f, err := DecodeFile(r, "image", tt.limit)
+
+		if tt.status == 0 {
+			if err != nil {
+				t.Fatalf("%s: decoding: %s", tt.name, err)
+			}
+			if f.Name != "cover.png" || !bytes.Equal(f.Data, tt.data) {
+				t.Fatalf("%s: expected cover.png with %q, got %s with %q", tt.name, tt.data, f.Name, f.Data)
+			}
+			continue
+		}
+
+		webErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("%s: expected a *web.Error, got %v", tt.name, err)
+		}
+		if webErr.Status != tt.status {
+			t.Fatalf("%s: expected status %v, got %v: %v", tt.name, tt.status, webErr.Status, err)
+		}
+		if diff := cmp.Diff(tt.fields, webErr.Fields); diff != "" {
+			t.Fatalf("%s: fields did not match expected. Diff:\n%s", tt.name, diff)
+		}
+	}
+
+	// A malformed body is reported rather than treated as a missing file.
+	r := httptest.NewRequest("POST", "/", strings.NewReader("not a form"))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+	_, err := DecodeFile(r, "image", 0)
+	if webErr, ok := err.(*Error); !ok || webErr.Code != "malformed_body" {
+		t.Fatalf("malformed: expected a malformed_body error, got %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
 	"go.opencensus.io/trace"
@@ -25,6 +26,7 @@ type Values struct {
 	TraceID    string
 	StatusCode int
 	Start      time.Time
+	Accept     string
 }
 
 // Handler is the signature used by all application handlers in this service.
@@ -61,6 +63,11 @@ func NewApp(shutdown chan os.Signal, log *log.Logger, mw ...Middleware) *App {
 		Propagation: &tracecontext.HTTPFormat{},
 	}
 
+	// Replace the router's plain text responses for unknown routes so they are
+	// logged, measured and answered like any other error.
+	app.NotFound(notFound)
+	app.MethodNotAllowed(methodNotAllowed)
+
 	return &app
 }
 
@@ -69,6 +76,46 @@ func NewApp(shutdown chan os.Signal, log *log.Logger, mw ...Middleware) *App {
 // It converts our custom handler type to the std lib Handler type. It captures
 // errors from the handler and serves them to the client in a uniform way.
 func (a *App) Handle(method, url string, h Handler, mw ...Middleware) {
+	a.mux.MethodFunc(method, url, a.wrap(h, mw...))
+}
+
+// Group creates a Group of routes which share a URL prefix and a set of
+// Middleware. The group Middleware runs after the application's general
+// Middleware and before any handler specific Middleware.
+func (a *App) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		app:    a,
+		prefix: prefix,
+		mw:     mw,
+	}
+}
+
+// Mount attaches an http.Handler to every request under the URL pattern. Since
+// an *App is an http.Handler this is also how sub-apps, with their own
+// middleware, are attached to a parent App. A sub-app routes on the part of
+// the path after the pattern, but the request URL is left whole, so a plain
+// handler which expects the shorter path must be wrapped in http.StripPrefix.
+func (a *App) Mount(pattern string, h http.Handler) {
+	a.mux.Mount(pattern, h)
+}
+
+// NotFound sets the handler used when no route matches the request URL. The
+// handler runs through the same middleware chain as any other route.
+func (a *App) NotFound(h Handler, mw ...Middleware) {
+	a.mux.NotFound(a.wrap(h, mw...))
+}
+
+// MethodNotAllowed sets the handler used when a route matches the request URL
+// but not its method. The handler runs through the same middleware chain as
+// any other route.
+func (a *App) MethodNotAllowed(h Handler, mw ...Middleware) {
+	a.mux.MethodNotAllowed(a.wrap(h, mw...))
+}
+
+// wrap builds the middleware chain around a handler and converts it to the std
+// lib HandlerFunc type. This is the first thing that will be executed when a
+// route is called.
+func (a *App) wrap(h Handler, mw ...Middleware) http.HandlerFunc {
 
 	// First wrap handler specific middleware around this handler.
 	h = wrapMiddleware(mw, h)
@@ -77,7 +124,6 @@ func (a *App) Handle(method, url string, h Handler, mw ...Middleware) {
 	h = wrapMiddleware(a.mw, h)
 
 	// Create a function that conforms to the std lib definition of a handler.
-	// This is the first thing that will be executed when this route is called.
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := trace.StartSpan(r.Context(), "internal.platform.web")
 		defer span.End()
@@ -87,6 +133,7 @@ func (a *App) Handle(method, url string, h Handler, mw ...Middleware) {
 		v := Values{
 			TraceID: span.SpanContext().TraceID.String(),
 			Start:   time.Now(),
+			Accept:  r.Header.Get("Accept"),
 		}
 		ctx = context.WithValue(ctx, KeyValues, &v)
 
@@ -99,7 +146,7 @@ func (a *App) Handle(method, url string, h Handler, mw ...Middleware) {
 		}
 	}
 
-	a.mux.MethodFunc(method, url, fn)
+	return fn
 }
 
 // ServeHTTP implements the http.Handler interface.
@@ -107,6 +154,19 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.och.ServeHTTP(w, r)
 }
 
+// notFound is the default handler for requests that do not match any route.
+func notFound(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	err := errors.Errorf("no route for %s", r.URL.Path)
+	return NewRequestError(err, http.StatusNotFound)
+}
+
+// methodNotAllowed is the default handler for requests that match a route but
+// use a method the route does not support.
+func methodNotAllowed(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	err := errors.Errorf("method %s not allowed for %s", r.Method, r.URL.Path)
+	return NewRequestError(err, http.StatusMethodNotAllowed)
+}
+
 // SignalShutdown is used to gracefully shutdown the app when an integrity
 // issue is identified.
 func (a *App) SignalShutdown() {
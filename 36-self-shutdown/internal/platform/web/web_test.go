@@ -0,0 +1,159 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// respondErrors is a minimal version of mid.Errors so the web package can be
+// tested without importing the middleware package.
+func respondErrors(before Handler) Handler {
+	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if err := before(ctx, w, r); err != nil {
+			return RespondError(ctx, w, err)
+		}
+		return nil
+	}
+	return h
+}
+
+// header returns Middleware which appends value to the X-Chain response
+// header so tests can check which middleware ran and in which order.
+func header(value string) Middleware {
+	return func(after Handler) Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			w.Header().Add("X-Chain", value)
+			return after(ctx, w, r)
+		}
+		return h
+	}
+}
+
+func ok(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func newTestApp() *App {
+	shutdown := make(chan os.Signal, 1)
+	logger := log.New(ioutil.Discard, "", 0)
+	return NewApp(shutdown, logger, respondErrors, header("app"))
+}
+
+func TestGroup(t *testing.T) {
+	app := newTestApp()
+
+	g := app.Group("/v1", header("v1"))
+	g.Handle(http.MethodGet, "/a", ok, header("a"))
+	g.Group("/nested", header("nested")).Handle(http.MethodGet, "/b", ok)
+	g.Handle(http.MethodGet, "/c", ok)
+
+	tests := []struct {
+		url   string
+		chain []string
+	}{
+		{"/v1/a", []string{"app", "v1", "a"}},
+		{"/v1/nested/b", []string{"app", "v1", "nested"}},
+		{"/v1/c", []string{"app", "v1"}},
+	}
+
+	for _, tt := range tests {
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+		if resp.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected status code %v, got %v", tt.url, http.StatusNoContent, resp.Code)
+		}
+
+		got := resp.Header()["X-Chain"]
+		if len(got) != len(tt.chain) {
+			t.Fatalf("%s: expected middleware %v, got %v", tt.url, tt.chain, got)
+		}
+		for i := range got {
+			if got[i] != tt.chain[i] {
+				t.Fatalf("%s: expected middleware %v, got %v", tt.url, tt.chain, got)
+			}
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	app := newTestApp()
+
+	sub := newTestApp()
+	sub.Handle(http.MethodGet, "/sub", ok)
+	app.Mount("/app", sub)
+
+	// Plain handlers see the whole path unless the prefix is stripped.
+	var path string
+	std := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusTeapot)
+	})
+	app.Mount("/std", std)
+	app.Mount("/stripped", http.StripPrefix("/stripped", std))
+
+	tests := []struct {
+		url    string
+		status int
+		path   string
+	}{
+		{"/app/sub", http.StatusNoContent, ""},
+		{"/std/anything", http.StatusTeapot, "/std/anything"},
+		{"/stripped/anything", http.StatusTeapot, "/anything"},
+	}
+
+	for _, tt := range tests {
+		path = ""
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+		if resp.Code != tt.status {
+			t.Fatalf("%s: expected status code %v, got %v", tt.url, tt.status, resp.Code)
+		}
+		if path != tt.path {
+			t.Fatalf("%s: expected the handler to see path %q, got %q", tt.url, tt.path, path)
+		}
+	}
+}
+
+func TestNotFoundAndMethodNotAllowed(t *testing.T) {
+	app := newTestApp()
+	app.Handle(http.MethodGet, "/exists", ok)
+
+	tests := []struct {
+		method string
+		url    string
+		status int
+	}{
+		{http.MethodGet, "/missing", http.StatusNotFound},
+		{http.MethodPost, "/exists", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, httptest.NewRequest(tt.method, tt.url, nil))
+
+		if resp.Code != tt.status {
+			t.Fatalf("%s %s: expected status code %v, got %v", tt.method, tt.url, tt.status, resp.Code)
+		}
+
+		// The app middleware should have run for unmatched routes too.
+		if got := resp.Header().Get("X-Chain"); got != "app" {
+			t.Fatalf("%s %s: expected app middleware to run, got %q", tt.method, tt.url, got)
+		}
+
+		var er ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+			t.Fatalf("%s %s: decoding: %s", tt.method, tt.url, err)
+		}
+		if er.Error == "" {
+			t.Fatalf("%s %s: expected an error message in the response", tt.method, tt.url)
+		}
+	}
+}
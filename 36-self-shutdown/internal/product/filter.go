@@ -0,0 +1,305 @@
+package product
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/database"
+)
+
+// Filter restricts and orders the Products returned by List. Its tags let it
+// be bound from a query string with web.DecodeQuery. Fields left at their
+// zero value do not restrict anything.
+type Filter struct {
+
+	// Name matches Products whose name contains it, ignoring case.
+	Name string `query:"name"`
+
+	// MinCost and MaxCost bound the amount of the cost of a Product,
+	// inclusively. Amounts are only comparable within one currency, so they
+	// are best used together with Currency.
+	MinCost *int `query:"min_cost" validate:"omitempty,gte=0"`
+	MaxCost *int `query:"max_cost" validate:"omitempty,gte=0"`
+
+	// Currency matches Products sold in that currency.
+	Currency string `query:"currency" validate:"omitempty,iso4217"`
+
+	// UserID matches Products owned by that user.
+	UserID string `query:"user_id" validate:"omitempty,uuid"`
+
+	// MinStock and MaxStock bound how many units are left to sell, which is
+	// the quantity less the number sold, inclusively.
+	MinStock *int `query:"min_stock"`
+	MaxStock *int `query:"max_stock"`
+
+	// CreatedAfter and CreatedBefore bound when a Product was created,
+	// exclusively.
+	CreatedAfter  *time.Time `query:"created_after"`
+	CreatedBefore *time.Time `query:"created_before"`
+
+	// Category matches Products filed under that category or any category
+	// below it in the tree.
+	Category string `query:"category" validate:"omitempty,uuid"`
+
+	// Tags matches Products which have every one of the tags.
+	Tags []string `query:"tag" validate:"dive,required"`
+
+	// Sort names the column to order by. A leading "-" sorts in descending
+	// order. The default is the order Products were created.
+	Sort string `query:"sort" validate:"omitempty,oneof=name -name cost -cost user_id -user_id stock -stock date_created -date_created"`
+}
+
+// column is something Products can be filtered and sorted by.
+type column struct {
+
+	// expr is the SQL expression for the column.
+	expr string
+
+	// aggregate is set when expr uses the sales totals, so it can only be
+	// tested after rows are grouped.
+	aggregate bool
+
+	// key gives the value of the column for p as a cursor key.
+	key func(p *Product) string
+
+	// valid reports whether a cursor key is a value of the column.
+	valid func(key string) bool
+}
+
+// columns is the whitelist of sortable columns. Only these expressions are
+// ever written into a query.
+var columns = map[string]column{
+	"name": {
+		expr:  "p.name",
+		key:   func(p *Product) string { return p.Name },
+		valid: func(string) bool { return true },
+	},
+	"cost": {
+		expr:  "(p.cost).amount",
+		key:   func(p *Product) string { return strconv.Itoa(p.Cost.Amount) },
+		valid: intKey,
+	},
+	"user_id": {
+		expr:  "p.user_id",
+		key:   func(p *Product) string { return p.UserID },
+		valid: uuidKey,
+	},
+	"stock": {
+		expr:      "p.quantity - COALESCE(SUM(s.quantity), 0)",
+		aggregate: true,
+		key:       func(p *Product) string { return strconv.Itoa(p.Quantity - p.Sold) },
+		valid:     intKey,
+	},
+	"date_created": {
+		expr:  "p.date_created",
+		key:   func(p *Product) string { return database.TimeKey(p.DateCreated) },
+		valid: timeKey,
+	},
+}
+
+// defaultSort is used when a Filter does not name a sort column.
+const defaultSort = "date_created"
+
+// productColumns selects everything about a Product from products AS p
+// joined to netSales AS s and grouped by p.product_id.
+const productColumns = `p.product_id, p.name, p.cost, p.quantity, p.user_id,
+		p.date_created, p.date_updated, p.deleted_at,
+		COALESCE(SUM(s.quantity), 0) AS sold,
+		ROW(COALESCE(SUM((s.paid).amount), 0), (p.cost).currency)::monetary AS revenue,
+		ARRAY(
+			SELECT pc.category_id::text FROM product_categories AS pc
+			WHERE pc.product_id = p.product_id ORDER BY 1
+		) AS categories,
+		ARRAY(
+			SELECT t.name FROM product_tags AS pt
+			JOIN tags AS t ON t.tag_id = pt.tag_id
+			WHERE pt.product_id = p.product_id ORDER BY 1
+		) AS tags,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'id', i.image_id,
+				'product_id', i.product_id,
+				'url', i.url,
+				'thumbnail_url', i.thumbnail_url,
+				'content_type', i.content_type,
+				'size', i.size,
+				'width', i.width,
+				'height', i.height,
+				'date_created', i.date_created AT TIME ZONE 'UTC'
+			) ORDER BY i.date_created, i.image_id)
+			FROM product_images AS i WHERE i.product_id = p.product_id
+		), '[]') AS images`
+
+// listQuery selects Products along with their sales totals. The placeholders
+// are filled with the WHERE conditions, the HAVING conditions and the ORDER
+// BY terms.
+const listQuery = `SELECT ` + productColumns + `
+	FROM products AS p
+	LEFT JOIN ` + netSales + ` AS s ON p.product_id = s.product_id
+	WHERE %s
+	GROUP BY p.product_id
+	HAVING %s
+	ORDER BY %s`
+
+// categoryCond matches Products filed under a category or its descendants.
+// The %s is the placeholder for the category ID.
+const categoryCond = `p.product_id IN (
+		SELECT pc.product_id FROM product_categories AS pc
+		WHERE pc.category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT category_id FROM categories WHERE category_id = %s
+				UNION
+				SELECT c.category_id FROM categories AS c
+				JOIN tree ON c.parent_id = tree.category_id
+			)
+			SELECT category_id FROM tree
+		)
+	)`
+
+// tagCond matches Products with a tag. The %s is the placeholder for the tag.
+const tagCond = `EXISTS (
+		SELECT 1 FROM product_tags AS pt
+		JOIN tags AS t ON t.tag_id = pt.tag_id
+		WHERE pt.product_id = p.product_id AND t.name = %s
+	)`
+
+// listBuilder collects the conditions and arguments of a listQuery.
+type listBuilder struct {
+	where  []string
+	having []string
+	args   []interface{}
+}
+
+// arg adds value to the arguments and returns its placeholder.
+func (b *listBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// add adds the condition "c.expr op value" to the query.
+func (b *listBuilder) add(c column, op string, value interface{}) {
+	b.cond(c, fmt.Sprintf("%s %s %s", c.expr, op, b.arg(value)))
+}
+
+// cond adds a condition to WHERE or HAVING depending on whether c is an
+// aggregate.
+func (b *listBuilder) cond(c column, cond string) {
+	if c.aggregate {
+		b.having = append(b.having, cond)
+		return
+	}
+	b.where = append(b.where, cond)
+}
+
+// buildList turns f and page into a listQuery with its arguments. Only
+// Products in the trash are listed when trash is set, otherwise they are
+// hidden. It also returns a function which makes the cursor following a
+// Product. Errors are only possible for values which validation cannot catch,
+// like a cursor made for a different sort.
+func buildList(f Filter, page database.Page, trash bool) (string, []interface{}, func(p *Product) *database.Cursor, error) {
+	sort := f.Sort
+	if sort == "" {
+		sort = defaultSort
+	}
+	name := strings.TrimPrefix(sort, "-")
+	desc := name != sort
+
+	sc, ok := columns[name]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("unknown sort %q", sort)
+	}
+
+	var b listBuilder
+
+	if trash {
+		b.where = append(b.where, "p.deleted_at IS NOT NULL")
+	} else {
+		b.where = append(b.where, "p.deleted_at IS NULL")
+	}
+
+	if f.Name != "" {
+		b.add(columns["name"], "ILIKE", "%"+escapeLike(f.Name)+"%")
+	}
+	if f.MinCost != nil {
+		b.add(columns["cost"], ">=", *f.MinCost)
+	}
+	if f.MaxCost != nil {
+		b.add(columns["cost"], "<=", *f.MaxCost)
+	}
+	if f.Currency != "" {
+		b.where = append(b.where, "(p.cost).currency = "+b.arg(f.Currency))
+	}
+	if f.UserID != "" {
+		b.add(columns["user_id"], "=", f.UserID)
+	}
+	if f.MinStock != nil {
+		b.add(columns["stock"], ">=", *f.MinStock)
+	}
+	if f.MaxStock != nil {
+		b.add(columns["stock"], "<=", *f.MaxStock)
+	}
+	if f.CreatedAfter != nil {
+		b.add(columns["date_created"], ">", f.CreatedAfter.UTC())
+	}
+	if f.CreatedBefore != nil {
+		b.add(columns["date_created"], "<", f.CreatedBefore.UTC())
+	}
+	if f.Category != "" {
+		b.where = append(b.where, fmt.Sprintf(categoryCond, b.arg(f.Category)))
+	}
+	for _, tag := range normalizeTags(f.Tags) {
+		b.where = append(b.where, fmt.Sprintf(tagCond, b.arg(tag)))
+	}
+
+	// Rows after the cursor sort after it on the sort column, or tie on it
+	// and sort after it on ID. Rows up to Until are the reverse.
+	after, until, dir := ">", "<=", "ASC"
+	if desc {
+		after, until, dir = "<", ">=", "DESC"
+	}
+	for _, c := range []struct {
+		cursor *database.Cursor
+		op     string
+	}{{page.After, after}, {page.Until, until}} {
+		if c.cursor == nil {
+			continue
+		}
+		if err := checkCursor(c.cursor, sort, sc.valid); err != nil {
+			return "", nil, nil, err
+		}
+		key, id := b.arg(c.cursor.Key), b.arg(c.cursor.ID)
+		b.cond(sc, fmt.Sprintf("(%s, p.product_id) %s (%s, %s)", sc.expr, c.op, key, id))
+	}
+
+	q := fmt.Sprintf(listQuery,
+		joinConds(b.where),
+		joinConds(b.having),
+		fmt.Sprintf("%s %s, p.product_id %s", sc.expr, dir, dir),
+	)
+
+	if page.Limit > 0 {
+		q += " LIMIT " + b.arg(page.Limit+1)
+	}
+
+	next := func(p *Product) *database.Cursor {
+		return &database.Cursor{Sort: sort, Key: sc.key(p), ID: p.ID}
+	}
+
+	return q, b.args, next, nil
+}
+
+// joinConds combines conditions with AND. No conditions are always true.
+func joinConds(conds []string) string {
+	if len(conds) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// escapeLike escapes the characters which are special in a LIKE pattern so
+// s is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
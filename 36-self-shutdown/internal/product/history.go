@@ -0,0 +1,289 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Actions recorded in the history of a Product.
+const (
+	HistoryCreate  = "create"
+	HistoryUpdate  = "update"
+	HistoryDelete  = "delete"
+	HistoryRestore = "restore"
+)
+
+// Version is one entry in the history of a Product. Versions are numbered
+// from 1 in the order they happened. UserID is the subject of the claims
+// which made the change.
+type Version struct {
+	ProductID   string    `db:"product_id" json:"product_id"`
+	Version     int       `db:"version" json:"version"`
+	Action      string    `db:"action" json:"action"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	Changes     Changes   `db:"changes" json:"changes"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// Change is the value of a field before and after a Version. Each is the
+// field's JSON representation, which is null when the field had no value.
+type Change struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// Changes holds a Change for every field which a Version changed. Fields are
+// named as they are in the JSON form of a Product.
+type Changes map[string]Change
+
+// Value implements the driver.Valuer interface. The JSON is given as a string
+// since the driver would send a []byte as binary data.
+func (c Changes) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding changes")
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (c *Changes) Scan(src interface{}) error {
+	data, ok := src.([]byte)
+	if !ok {
+		return errors.Errorf("cannot scan %T into Changes", src)
+	}
+
+	changes := Changes{}
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return errors.Wrap(err, "scanning changes")
+	}
+
+	*c = changes
+	return nil
+}
+
+// versionSort is the Sort of cursors made by History.
+const versionSort = "version"
+
+// History gets a page of the Versions of the Product identified by productID,
+// oldest first. The history of a deleted Product can still be read, even
+// once it is purged.
+func History(ctx context.Context, db *sqlx.DB, productID string, page database.Page) ([]Version, *database.Cursor, error) {
+	ctx, span := trace.StartSpan(ctx, "product.History")
+	defer span.End()
+
+	if err := recorded(ctx, db, productID); err != nil {
+		return nil, nil, err
+	}
+	if err := checkCursor(page.After, versionSort, intKey); err != nil {
+		return nil, nil, err
+	}
+
+	const historyQuery = `SELECT * FROM product_history
+		WHERE product_id = $1 AND %s
+		ORDER BY version`
+
+	q, args := pageQuery(historyQuery, "version, product_id", page, productID)
+
+	versions := []Version{}
+	if err := db.SelectContext(ctx, &versions, q, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "selecting history")
+	}
+
+	if page.Limit <= 0 || len(versions) <= page.Limit {
+		return versions, nil, nil
+	}
+
+	versions = versions[:page.Limit]
+	last := versions[len(versions)-1]
+	next := database.Cursor{Sort: versionSort, Key: strconv.Itoa(last.Version), ID: last.ProductID}
+	return versions, &next, nil
+}
+
+// AsOf reconstructs the Product identified by productID as it was at the
+// given time by replaying its history. Sold and Revenue only count sales and
+// refunds made by then. Voided sales are left out even if they were voided
+// later. Images are not versioned so none are included. It fails with
+// ErrNotFound if the Product did not exist or was deleted at that time.
+func AsOf(ctx context.Context, db *sqlx.DB, productID string, at time.Time) (*Product, error) {
+	ctx, span := trace.StartSpan(ctx, "product.AsOf")
+	defer span.End()
+
+	if err := recorded(ctx, db, productID); err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	const q = `SELECT * FROM product_history
+		WHERE product_id = $1 AND date_created <= $2
+		ORDER BY version`
+	if err := db.SelectContext(ctx, &versions, q, productID, at.UTC()); err != nil {
+		return nil, errors.Wrap(err, "selecting history")
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	// Apply each change to the JSON form of the Product in turn.
+	state := make(map[string]json.RawMessage)
+	for _, v := range versions {
+		for field, c := range v.Changes {
+			state[field] = c.To
+		}
+	}
+	doc, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "rebuilding product")
+	}
+
+	p := Product{Images: Images{}}
+	if err := json.Unmarshal(doc, &p); err != nil {
+		return nil, errors.Wrap(err, "rebuilding product")
+	}
+	if p.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	p.ID = productID
+	p.DateCreated = versions[0].DateCreated
+	for _, v := range versions {
+		if v.Action == HistoryCreate || v.Action == HistoryUpdate {
+			p.DateUpdated = v.DateCreated
+		}
+	}
+
+	const ownerQ = `SELECT user_id FROM products WHERE product_id = $1`
+	if err := db.GetContext(ctx, &p.UserID, ownerQ, productID); err != nil {
+		return nil, errors.Wrap(err, "selecting product owner")
+	}
+
+	const salesQ = `SELECT COALESCE(SUM(quantity), 0), COALESCE(SUM(paid), 0) FROM (
+			SELECT quantity, (paid).amount AS paid FROM sales
+			WHERE product_id = $1 AND date_created <= $2 AND voided_at IS NULL
+			UNION ALL
+			SELECT -r.quantity, -(r.amount).amount FROM refunds AS r
+			JOIN sales AS s ON s.sale_id = r.sale_id
+			WHERE s.product_id = $1 AND r.date_created <= $2 AND s.voided_at IS NULL
+		) AS t`
+	if err := db.QueryRowxContext(ctx, salesQ, productID, at.UTC()).Scan(&p.Sold, &p.Revenue.Amount); err != nil {
+		return nil, errors.Wrap(err, "totaling sales")
+	}
+	p.Revenue.Currency = p.Cost.Currency
+
+	return &p, nil
+}
+
+// recorded checks that productID is well formed and identifies a Product
+// with a history, even one in the trash or purged.
+func recorded(ctx context.Context, db *sqlx.DB, productID string) error {
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+
+	var found bool
+	const q = `SELECT EXISTS (SELECT 1 FROM product_history WHERE product_id = $1)`
+	if err := db.GetContext(ctx, &found, q, productID); err != nil {
+		return errors.Wrap(err, "checking product exists")
+	}
+	if !found {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// versioned gives the fields of p which are kept in its history, in their
+// JSON form. A nil p has no fields.
+func versioned(p *Product) (map[string]json.RawMessage, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	values := map[string]interface{}{
+		"name":       p.Name,
+		"cost":       p.Cost,
+		"quantity":   p.Quantity,
+		"categories": p.Categories,
+		"tags":       p.Tags,
+		"deleted_at": p.DeletedAt,
+	}
+
+	fields := make(map[string]json.RawMessage, len(values))
+	for name, v := range values {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encoding %s", name)
+		}
+		fields[name] = raw
+	}
+
+	return fields, nil
+}
+
+// diff finds the versioned fields which differ between before and after.
+// Either can be nil, such as before a Product is created.
+func diff(before, after *Product) (Changes, error) {
+	from, err := versioned(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := versioned(after)
+	if err != nil {
+		return nil, err
+	}
+
+	null := json.RawMessage("null")
+	changes := Changes{}
+	for _, fields := range []map[string]json.RawMessage{from, to} {
+		for name := range fields {
+			f, ok := from[name]
+			if !ok {
+				f = null
+			}
+			t, ok := to[name]
+			if !ok {
+				t = null
+			}
+			if !bytes.Equal(f, t) {
+				changes[name] = Change{From: f, To: t}
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// record adds the next Version to the history of the Product identified by
+// productID. The caller must hold a lock on the Product so versions are not
+// numbered twice. Versions which change nothing are not recorded.
+func record(ctx context.Context, tx *sqlx.Tx, user auth.Claims, productID, action string, before, after *Product, now time.Time) error {
+	changes, err := diff(before, after)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 && action == HistoryUpdate {
+		return nil
+	}
+
+	const q = `INSERT INTO product_history
+		(product_id, version, action, user_id, changes, date_created)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5
+		FROM product_history WHERE product_id = $1`
+
+	if _, err := tx.ExecContext(ctx, q, productID, action, user.Subject, changes, now.UTC()); err != nil {
+		return errors.Wrapf(err, "recording %s of product %s", action, productID)
+	}
+
+	return nil
+}
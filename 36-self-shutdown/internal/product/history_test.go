@@ -0,0 +1,138 @@
+package product_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/a2go/garagesale/internal/product"
+	"github.com/a2go/garagesale/internal/tests"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestHistory(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	created := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	deleted := created.Add(2 * time.Hour)
+	restored := created.Add(3 * time.Hour)
+	ctx := context.Background()
+
+	owner := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, created, time.Hour)
+	admin := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, created, time.Hour)
+
+	p, err := product.Create(ctx, db, owner, product.NewProduct{Name: "Comic Books", Cost: tests.USD(10), Quantity: 5, Tags: []string{"vintage"}}, created)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	original := *p
+
+	if err := product.Update(ctx, db, admin, p.ID, product.UpdateProduct{Cost: tests.MoneyPointer(tests.USD(25))}, updated); err != nil {
+		t.Fatalf("updating product: %s", err)
+	}
+	if err := product.Update(ctx, db, admin, p.ID, product.UpdateProduct{Cost: tests.MoneyPointer(tests.USD(25))}, updated); err != nil {
+		t.Fatalf("updating product again: %s", err)
+	}
+	if err := product.Delete(ctx, db, owner, p.ID, deleted); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+	if err := product.Restore(ctx, db, admin, p.ID, restored); err != nil {
+		t.Fatalf("restoring product: %s", err)
+	}
+
+	versions, _, err := product.History(ctx, db, p.ID, database.Page{})
+	if err != nil {
+		t.Fatalf("getting history: %s", err)
+	}
+
+	// The second update changed nothing so it was not recorded.
+	type summary struct {
+		Version int
+		Action  string
+		UserID  string
+		Fields  []string
+	}
+	var got []summary
+	for _, v := range versions {
+		s := summary{Version: v.Version, Action: v.Action, UserID: v.UserID}
+		for _, f := range []string{"name", "cost", "quantity", "categories", "tags", "deleted_at"} {
+			if _, ok := v.Changes[f]; ok {
+				s.Fields = append(s.Fields, f)
+			}
+		}
+		got = append(got, s)
+	}
+	want := []summary{
+		{1, product.HistoryCreate, tests.UserID, []string{"name", "cost", "quantity", "categories", "tags"}},
+		{2, product.HistoryUpdate, tests.AdminID, []string{"cost"}},
+		{3, product.HistoryDelete, tests.UserID, []string{"deleted_at"}},
+		{4, product.HistoryRestore, tests.AdminID, []string{"deleted_at"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("history did not match expected. Diff:\n%s", diff)
+	}
+
+	var from, to money.Money
+	cost := versions[1].Changes["cost"]
+	if err := json.Unmarshal(cost.From, &from); err != nil {
+		t.Fatalf("decoding cost: %s", err)
+	}
+	if err := json.Unmarshal(cost.To, &to); err != nil {
+		t.Fatalf("decoding cost: %s", err)
+	}
+	if from != tests.USD(10) || to != tests.USD(25) {
+		t.Fatalf("expected cost to change from 10 to 25, got %s to %s", cost.From, cost.To)
+	}
+	if raw, _ := json.Marshal(versions[0].Changes["tags"].To); string(raw) != `["vintage"]` {
+		t.Fatalf("expected tags to be created as [\"vintage\"], got %s", raw)
+	}
+
+	// Paging through one version at a time gives the same versions.
+	page := database.Page{Limit: 1}
+	for i := range versions {
+		got, next, err := product.History(ctx, db, p.ID, page)
+		if err != nil {
+			t.Fatalf("getting history page: %s", err)
+		}
+		if len(got) != 1 || got[0].Version != versions[i].Version {
+			t.Fatalf("page %d: expected version %d, got %+v", i, versions[i].Version, got)
+		}
+		if (next == nil) != (i == len(versions)-1) {
+			t.Fatalf("page %d: unexpected next cursor %v", i, next)
+		}
+		page.After = next
+	}
+
+	// The product can be rebuilt as it was at any time it existed.
+	before, err := product.AsOf(ctx, db, p.ID, updated.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("getting product before update: %s", err)
+	}
+	if diff := cmp.Diff(original, *before); diff != "" {
+		t.Fatalf("product before update did not match created. Diff:\n%s", diff)
+	}
+
+	after, err := product.AsOf(ctx, db, p.ID, updated)
+	if err != nil {
+		t.Fatalf("getting product after update: %s", err)
+	}
+	if after.Cost != tests.USD(25) || !after.DateUpdated.Equal(updated) {
+		t.Fatalf("expected cost 25 updated at %v, got %+v", updated, after)
+	}
+
+	for _, at := range []time.Time{created.Add(-time.Second), deleted.Add(time.Minute)} {
+		if _, err := product.AsOf(ctx, db, p.ID, at); errors.Cause(err) != product.ErrNotFound {
+			t.Fatalf("expected %v as of %v, got %v", product.ErrNotFound, at, err)
+		}
+	}
+	if _, err := product.AsOf(ctx, db, p.ID, restored); err != nil {
+		t.Fatalf("getting restored product: %s", err)
+	}
+}
@@ -0,0 +1,269 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"image"
+	_ "image/gif" // Register the GIF decoder.
+	"image/jpeg"
+	_ "image/png" // Register the PNG decoder.
+	"net/http"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/blob"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Predefined errors for Product images.
+var (
+	// ErrImageNotFound is used when a specific Image is requested but does
+	// not exist.
+	ErrImageNotFound = errors.New("image not found")
+
+	// ErrUnsupportedImage is used when an upload is not a JPEG, PNG or GIF
+	// image or cannot be decoded as one.
+	ErrUnsupportedImage = errors.New("image must be a JPEG, PNG or GIF")
+
+	// ErrImageTooLarge is used when an image has more pixels than we are
+	// willing to decode.
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+)
+
+func init() {
+	web.RegisterError(ErrImageNotFound, http.StatusNotFound, "image_not_found")
+	web.RegisterError(ErrUnsupportedImage, http.StatusUnsupportedMediaType, "unsupported_image")
+	web.RegisterError(ErrImageTooLarge, http.StatusBadRequest, "image_too_large")
+}
+
+// imageTypes maps the content types accepted for images to the extension
+// their files are stored with.
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+const (
+
+	// maxImagePixels bounds the size of a decoded image. A small compressed
+	// file can describe a huge image so this is checked before decoding. It
+	// allows the 24 megapixels of most cameras, which decode to at most 96MB.
+	maxImagePixels = 25000000
+
+	// thumbnailSize is the largest width or height of a thumbnail.
+	thumbnailSize = 200
+)
+
+// AddImage stores data as a new image of the Product identified by
+// productID along with a thumbnail of it. Its type is sniffed from the data
+// rather than trusted from the client. Only users who may update the Product
+// can add images to it.
+func AddImage(ctx context.Context, db *sqlx.DB, store blob.Store, user auth.Claims, productID string, data []byte, now time.Time) (*Image, error) {
+	ctx, span := trace.StartSpan(ctx, "product.AddImage")
+	defer span.End()
+
+	if err := canUpdate(ctx, db, user, productID); err != nil {
+		return nil, err
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := imageTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, thumbnail(src, thumbnailSize), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, errors.Wrap(err, "encoding thumbnail")
+	}
+
+	id := uuid.New().String()
+	img := Image{
+		ID:           id,
+		ProductID:    productID,
+		Key:          "products/" + productID + "/" + id + ext,
+		ThumbnailKey: "products/" + productID + "/" + id + "_thumb.jpg",
+		ContentType:  contentType,
+		Size:         len(data),
+		Width:        cfg.Width,
+		Height:       cfg.Height,
+		DateCreated:  now.UTC(),
+	}
+	img.URL = store.URL(img.Key)
+	img.ThumbnailURL = store.URL(img.ThumbnailKey)
+
+	if err := store.Put(ctx, img.Key, bytes.NewReader(data), contentType); err != nil {
+		return nil, errors.Wrap(err, "storing image")
+	}
+	if err := store.Put(ctx, img.ThumbnailKey, &thumb, "image/jpeg"); err != nil {
+		removeBlobs(ctx, store, img.Key)
+		return nil, errors.Wrap(err, "storing thumbnail")
+	}
+
+	const q = `INSERT INTO product_images
+		(image_id, product_id, key, thumbnail_key, url, thumbnail_url,
+		content_type, size, width, height, date_created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, err = db.ExecContext(ctx, q,
+		img.ID, img.ProductID, img.Key, img.ThumbnailKey, img.URL, img.ThumbnailURL,
+		img.ContentType, img.Size, img.Width, img.Height, img.DateCreated)
+	if err != nil {
+		removeBlobs(ctx, store, img.Key, img.ThumbnailKey)
+		return nil, errors.Wrap(err, "inserting image")
+	}
+
+	return &img, nil
+}
+
+// ListImages gives all images of the Product identified by productID in the
+// order they were added.
+func ListImages(ctx context.Context, db *sqlx.DB, productID string) ([]Image, error) {
+	ctx, span := trace.StartSpan(ctx, "product.ListImages")
+	defer span.End()
+
+	if err := exists(ctx, db, productID); err != nil {
+		return nil, err
+	}
+
+	images := []Image{}
+	const q = `SELECT * FROM product_images WHERE product_id = $1
+		ORDER BY date_created, image_id`
+	if err := db.SelectContext(ctx, &images, q, productID); err != nil {
+		return nil, errors.Wrap(err, "selecting images")
+	}
+
+	return images, nil
+}
+
+// DeleteImage removes an image of the Product identified by productID and
+// its files. Only users who may update the Product can remove its images.
+func DeleteImage(ctx context.Context, db *sqlx.DB, store blob.Store, user auth.Claims, productID, imageID string) error {
+	ctx, span := trace.StartSpan(ctx, "product.DeleteImage")
+	defer span.End()
+
+	if err := canUpdate(ctx, db, user, productID); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(imageID); err != nil {
+		return ErrImageNotFound
+	}
+
+	var img Image
+	const q = `DELETE FROM product_images WHERE product_id = $1 AND image_id = $2
+		RETURNING key, thumbnail_key`
+	if err := db.GetContext(ctx, &img, q, productID, imageID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrImageNotFound
+		}
+		return errors.Wrapf(err, "deleting image %s", imageID)
+	}
+
+	return removeBlobs(ctx, store, img.Key, img.ThumbnailKey)
+}
+
+// canUpdate checks that productID identifies a Product which has not been
+// deleted and that user may update it.
+func canUpdate(ctx context.Context, db *sqlx.DB, user auth.Claims, productID string) error {
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+
+	p := Product{ID: productID}
+	const q = `SELECT user_id FROM products
+		WHERE product_id = $1 AND deleted_at IS NULL`
+	if err := db.GetContext(ctx, &p.UserID, q, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting owner of product %s", productID)
+	}
+
+	return Policy.Check(user, ActionUpdate, p.resource())
+}
+
+// removeBlobs deletes the files under keys from store. It carries on past
+// failures and returns the first one.
+func removeBlobs(ctx context.Context, store blob.Store, keys ...string) error {
+	var first error
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil && first == nil {
+			first = errors.Wrap(err, "removing image file")
+		}
+	}
+	return first
+}
+
+// thumbnail scales img down so neither side is longer than size, keeping its
+// aspect ratio. Each pixel of the thumbnail is the average of the pixels it
+// covers. Transparent areas are drawn over white since JPEG has no alpha.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	// Pixels are read from img as they are needed rather than copied first,
+	// which would take another four bytes for every pixel of a large image.
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+
+			var r, g, bl, n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+
+					// Colors are alpha premultiplied so adding the
+					// transparent part as white draws the pixel over white.
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r += int(pr + 0xffff - pa)
+					g += int(pg + 0xffff - pa)
+					bl += int(pb + 0xffff - pa)
+					n++
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n >> 8)
+			dst.Pix[j+1] = uint8(g / n >> 8)
+			dst.Pix[j+2] = uint8(bl / n >> 8)
+			dst.Pix[j+3] = 0xff
+		}
+	}
+
+	return dst
+}
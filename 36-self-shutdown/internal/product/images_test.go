@@ -0,0 +1,149 @@
+package product_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/blob"
+	"github.com/a2go/garagesale/internal/product"
+	"github.com/a2go/garagesale/internal/tests"
+	"github.com/pkg/errors"
+)
+
+func TestImages(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	store, cleanup := tests.NewImageStore(t)
+	defer cleanup()
+
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	owner := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, now, time.Hour)
+	other := auth.NewClaims(tests.AdminID, []string{auth.RoleUser}, now, time.Hour)
+
+	p, err := product.Create(ctx, db, owner, product.NewProduct{Name: "Comic Book", Cost: tests.USD(10), Quantity: 5}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	// A wide PNG is kept as it is with a JPEG thumbnail scaled to fit.
+	var buf bytes.Buffer
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	src.Set(0, 0, color.RGBA{R: 0xff, A: 0xff})
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("encoding png: %s", err)
+	}
+
+	img, err := product.AddImage(ctx, db, store, owner, p.ID, buf.Bytes(), now)
+	if err != nil {
+		t.Fatalf("adding image: %s", err)
+	}
+	if img.ContentType != "image/png" || img.Width != 400 || img.Height != 100 || img.Size != buf.Len() {
+		t.Fatalf("unexpected image: %+v", img)
+	}
+	if !strings.HasPrefix(img.URL, "/v1/images/products/"+p.ID+"/") || !strings.HasSuffix(img.URL, ".png") {
+		t.Fatalf("unexpected image URL %q", img.URL)
+	}
+
+	thumb := fetch(t, store, img.ThumbnailURL)
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("decoding thumbnail: %s", err)
+	}
+	if cfg.Width != 200 || cfg.Height != 50 {
+		t.Fatalf("expected a 200x50 thumbnail, got %dx%d", cfg.Width, cfg.Height)
+	}
+
+	// The image is part of the Product.
+	saved, err := product.Get(ctx, db, p.ID)
+	if err != nil {
+		t.Fatalf("getting product: %s", err)
+	}
+	if len(saved.Images) != 1 || saved.Images[0].ID != img.ID || saved.Images[0].ThumbnailURL != img.ThumbnailURL {
+		t.Fatalf("expected the image on the product, got %+v", saved.Images)
+	}
+	list, err := product.ListImages(ctx, db, p.ID)
+	if err != nil {
+		t.Fatalf("listing images: %s", err)
+	}
+	if len(list) != 1 || list[0].ID != img.ID || !list[0].DateCreated.Equal(now) {
+		t.Fatalf("expected the image in the list, got %+v", list)
+	}
+
+	{
+		// Uploads must be images and only users who may update the Product
+		// can change its images.
+		_, err := product.AddImage(ctx, db, store, owner, p.ID, []byte("just some text"), now)
+		if errors.Cause(err) != product.ErrUnsupportedImage {
+			t.Fatalf("expected %v adding text, got %v", product.ErrUnsupportedImage, err)
+		}
+		_, err = product.AddImage(ctx, db, store, other, p.ID, buf.Bytes(), now)
+		if errors.Cause(err) != product.ErrForbidden {
+			t.Fatalf("expected %v adding as another user, got %v", product.ErrForbidden, err)
+		}
+		err = product.DeleteImage(ctx, db, store, other, p.ID, img.ID)
+		if errors.Cause(err) != product.ErrForbidden {
+			t.Fatalf("expected %v deleting as another user, got %v", product.ErrForbidden, err)
+		}
+		_, err = product.ListImages(ctx, db, "9f3a77e0-4a9b-4a3f-8a3c-5b4f2a1c0d9e")
+		if errors.Cause(err) != product.ErrNotFound {
+			t.Fatalf("expected %v listing images of an unknown product, got %v", product.ErrNotFound, err)
+		}
+	}
+
+	if err := product.DeleteImage(ctx, db, store, owner, p.ID, img.ID); err != nil {
+		t.Fatalf("deleting image: %s", err)
+	}
+	if err := product.DeleteImage(ctx, db, store, owner, p.ID, img.ID); errors.Cause(err) != product.ErrImageNotFound {
+		t.Fatalf("expected %v deleting twice, got %v", product.ErrImageNotFound, err)
+	}
+	if code := get(store, img.URL).Code; code != http.StatusNotFound {
+		t.Fatalf("expected the image file to be removed, got %d", code)
+	}
+
+	// Purging a Product removes the files of its images.
+	img, err = product.AddImage(ctx, db, store, owner, p.ID, buf.Bytes(), now)
+	if err != nil {
+		t.Fatalf("adding image: %s", err)
+	}
+	if err := product.Delete(ctx, db, owner, p.ID, now); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+	if _, err := product.Purge(ctx, db, store, now.Add(time.Hour)); err != nil {
+		t.Fatalf("purging products: %s", err)
+	}
+	if code := get(store, img.ThumbnailURL).Code; code != http.StatusNotFound {
+		t.Fatalf("expected the thumbnail to be purged, got %d", code)
+	}
+}
+
+// get requests a URL given by a Local store from the store itself.
+func get(store *blob.Local, url string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", strings.TrimPrefix(url, "/v1/images"), nil)
+	store.ServeHTTP(w, r)
+	return w
+}
+
+// fetch gets the contents of a URL given by a Local store.
+func fetch(t *testing.T, store *blob.Local, url string) []byte {
+	t.Helper()
+
+	w := get(store, url)
+	if w.Code != http.StatusOK {
+		t.Fatalf("fetching %s: got status %d", url, w.Code)
+	}
+	return w.Body.Bytes()
+}
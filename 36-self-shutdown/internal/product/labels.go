@@ -0,0 +1,111 @@
+package product
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// setCategories replaces the categories a Product is filed under with ids. It
+// fails with ErrUnknownCategory if any of them do not exist.
+func setCategories(ctx context.Context, tx *sqlx.Tx, productID string, ids []string) error {
+	const del = `DELETE FROM product_categories WHERE product_id = $1`
+	if _, err := tx.ExecContext(ctx, del, productID); err != nil {
+		return errors.Wrap(err, "removing product categories")
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return ErrUnknownCategory
+		}
+	}
+
+	const q = `INSERT INTO product_categories (product_id, category_id)
+		SELECT $1, category_id FROM categories WHERE category_id = ANY($2)`
+	res, err := tx.ExecContext(ctx, q, productID, pq.Array(ids))
+	if err != nil {
+		return errors.Wrap(err, "inserting product categories")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "inserting product categories")
+	}
+	if n != int64(len(ids)) {
+		return ErrUnknownCategory
+	}
+
+	return nil
+}
+
+// setTags replaces the tags of a Product. Tags which have never been used
+// before are created.
+func setTags(ctx context.Context, tx *sqlx.Tx, productID string, tags []string) error {
+	const del = `DELETE FROM product_tags WHERE product_id = $1`
+	if _, err := tx.ExecContext(ctx, del, productID); err != nil {
+		return errors.Wrap(err, "removing product tags")
+	}
+
+	for _, tag := range tags {
+		const create = `INSERT INTO tags (tag_id, name) VALUES ($1, $2)
+			ON CONFLICT (name) DO NOTHING`
+		if _, err := tx.ExecContext(ctx, create, uuid.New().String(), tag); err != nil {
+			return errors.Wrapf(err, "inserting tag %q", tag)
+		}
+
+		const q = `INSERT INTO product_tags (product_id, tag_id)
+			SELECT $1, tag_id FROM tags WHERE name = $2`
+		if _, err := tx.ExecContext(ctx, q, productID, tag); err != nil {
+			return errors.Wrapf(err, "tagging product with %q", tag)
+		}
+	}
+
+	return nil
+}
+
+// normalizeIDs puts category IDs in the form the database returns them,
+// sorted and without duplicates. IDs which do not parse are kept as given.
+func normalizeIDs(ids []string) pq.StringArray {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id
+		if u, err := uuid.Parse(id); err == nil {
+			out[i] = u.String()
+		}
+	}
+	return dedupe(out)
+}
+
+// normalizeTags trims and lower cases tags so "Vintage " and "vintage" are the
+// same tag. They are sorted and duplicates removed.
+func normalizeTags(tags []string) pq.StringArray {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return dedupe(out)
+}
+
+// dedupe sorts values and removes duplicates. It never returns nil so an
+// empty set compares equal to one read from the database.
+func dedupe(values []string) pq.StringArray {
+	sort.Strings(values)
+
+	out := pq.StringArray{}
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -1,27 +1,47 @@
 package product
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 )
 
-// Product is an item we sell.
+// Product is an item we sell. The currency of its Cost is the currency it is
+// sold in, so its Sales and Revenue are in that currency too.
 type Product struct {
-	ID          string    `db:"product_id" json:"id"`
-	Name        string    `db:"name" json:"name"`
-	Cost        int       `db:"cost" json:"cost"`
-	Quantity    int       `db:"quantity" json:"quantity"`
-	Sold        int       `db:"sold" json:"sold"`
-	Revenue     int       `db:"revenue" json:"revenue"`
-	UserID      string    `db:"user_id" json:"user_id"`
-	DateCreated time.Time `db:"date_created" json:"date_created"`
-	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+	ID          string      `db:"product_id" json:"id"`
+	Name        string      `db:"name" json:"name"`
+	Cost        money.Money `db:"cost" json:"cost"`
+	Quantity    int         `db:"quantity" json:"quantity"`
+	Sold        int         `db:"sold" json:"sold"`
+	Revenue     money.Money `db:"revenue" json:"revenue"`
+	UserID      string      `db:"user_id" json:"user_id"`
+	DateCreated time.Time   `db:"date_created" json:"date_created"`
+	DateUpdated time.Time   `db:"date_updated" json:"date_updated"`
+
+	// Categories holds the IDs of the categories the Product is filed under
+	// and Tags its free-form labels. Both are kept sorted.
+	Categories pq.StringArray `db:"categories" json:"categories"`
+	Tags       pq.StringArray `db:"tags" json:"tags"`
+
+	// Images holds the Product's images in the order they were added.
+	Images Images `db:"images" json:"images"`
+
+	// DeletedAt is set while the Product is in the trash.
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 // NewProduct is what we require from clients when adding a Product.
 type NewProduct struct {
-	Name     string `json:"name" validate:"required"`
-	Cost     int    `json:"cost" validate:"gte=0"`
-	Quantity int    `json:"quantity" validate:"gte=1"`
+	Name        string      `json:"name" validate:"required"`
+	Cost        money.Money `json:"cost"`
+	Quantity    int         `json:"quantity" validate:"gte=1"`
+	CategoryIDs []string    `json:"category_ids" validate:"dive,uuid"`
+	Tags        []string    `json:"tags" validate:"dive,required,max=50"`
 }
 
 // UpdateProduct defines what information may be provided to modify an
@@ -29,27 +49,124 @@ type NewProduct struct {
 // fields they want changed. It uses pointer fields so we can differentiate
 // between a field that was not provided and a field that was provided as
 // explicitly blank. Normally we do not want to use pointers to basic types but
-// we make exceptions around marshalling/unmarshalling.
+// we make exceptions around marshalling/unmarshalling. CategoryIDs and Tags
+// replace the existing ones when provided. Cost must stay in the same
+// currency.
 type UpdateProduct struct {
-	Name     *string `json:"name"`
-	Cost     *int    `json:"cost" validate:"omitempty,gte=0"`
-	Quantity *int    `json:"quantity" validate:"omitempty,gte=1"`
+	Name        *string      `json:"name"`
+	Cost        *money.Money `json:"cost"`
+	Quantity    *int         `json:"quantity" validate:"omitempty,gte=1"`
+	CategoryIDs *[]string    `json:"category_ids" validate:"omitempty,dive,uuid"`
+	Tags        *[]string    `json:"tags" validate:"omitempty,dive,required,max=50"`
+}
+
+// Image is a picture of a Product. URL locates the image as uploaded and
+// ThumbnailURL a small JPEG version of it. Key and ThumbnailKey locate the
+// same files in the blob store.
+type Image struct {
+	ID           string    `db:"image_id" json:"id"`
+	ProductID    string    `db:"product_id" json:"product_id"`
+	Key          string    `db:"key" json:"-"`
+	ThumbnailKey string    `db:"thumbnail_key" json:"-"`
+	URL          string    `db:"url" json:"url"`
+	ThumbnailURL string    `db:"thumbnail_url" json:"thumbnail_url"`
+	ContentType  string    `db:"content_type" json:"content_type"`
+	Size         int       `db:"size" json:"size"`
+	Width        int       `db:"width" json:"width"`
+	Height       int       `db:"height" json:"height"`
+	DateCreated  time.Time `db:"date_created" json:"date_created"`
+}
+
+// Images is a list of Image which can be scanned from a JSON array column.
+type Images []Image
+
+// String implements the fmt.Stringer interface. It lists the image URLs,
+// which is how Images appear in CSV output.
+func (i Images) String() string {
+	urls := make([]string, len(i))
+	for j, img := range i {
+		urls[j] = img.URL
+	}
+	return fmt.Sprint(urls)
+}
+
+// Scan implements the sql.Scanner interface.
+func (i *Images) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*i = Images{}
+		return nil
+	default:
+		return errors.Errorf("cannot scan %T into Images", src)
+	}
+
+	images := Images{}
+	if err := json.Unmarshal(data, &images); err != nil {
+		return errors.Wrap(err, "scanning images")
+	}
+	for j := range images {
+		images[j].DateCreated = images[j].DateCreated.UTC()
+	}
+
+	*i = images
+	return nil
 }
 
 // Sale represents one item of a transaction where some amount of a product was
 // sold. Quantity is the number of units sold and Paid is the total price paid.
 // Note that due to haggling the Paid value might not equal Quantity sold *
-// Product cost.
+// Product cost, but it is always in the currency of the Product.
+//
+// Quantity and Paid are never changed. RefundedQuantity and Refunded total
+// the Refunds of the Sale. A voided Sale has VoidedAt set and counts for
+// nothing, as if it were never made.
 type Sale struct {
-	ID          string    `db:"sale_id" json:"id"`
-	ProductID   string    `db:"product_id" json:"product_id"`
-	Quantity    int       `db:"quantity" json:"quantity"`
-	Paid        int       `db:"paid" json:"paid"`
-	DateCreated time.Time `db:"date_created" json:"date_created"`
+	ID               string      `db:"sale_id" json:"id"`
+	ProductID        string      `db:"product_id" json:"product_id"`
+	Quantity         int         `db:"quantity" json:"quantity"`
+	Paid             money.Money `db:"paid" json:"paid"`
+	RefundedQuantity int         `db:"refunded_quantity" json:"refunded_quantity"`
+	Refunded         money.Money `db:"refunded" json:"refunded"`
+	DateCreated      time.Time   `db:"date_created" json:"date_created"`
+	VoidedAt         *time.Time  `db:"voided_at" json:"voided_at"`
+	VoidedBy         *string     `db:"voided_by" json:"voided_by"`
+	VoidReason       *string     `db:"void_reason" json:"void_reason"`
 }
 
 // NewSale is what we require from clients for recording new transactions.
 type NewSale struct {
-	Quantity int `json:"quantity" validate:"gte=0"`
-	Paid     int `json:"paid" validate:"gte=0"`
+	Quantity int         `json:"quantity" validate:"gte=1"`
+	Paid     money.Money `json:"paid"`
+}
+
+// Refund gives back some of a Sale. Quantity units are returned to stock
+// and Amount is paid back to the buyer. Either may be zero, such as for a
+// discount given after the sale. Amount is in the currency the Sale was paid
+// in. UserID is the subject of the claims which made the Refund.
+type Refund struct {
+	ID          string      `db:"refund_id" json:"id"`
+	SaleID      string      `db:"sale_id" json:"sale_id"`
+	Quantity    int         `db:"quantity" json:"quantity"`
+	Amount      money.Money `db:"amount" json:"amount"`
+	Reason      string      `db:"reason" json:"reason"`
+	UserID      string      `db:"user_id" json:"user_id"`
+	DateCreated time.Time   `db:"date_created" json:"date_created"`
+}
+
+// NewRefund is what we require from clients when refunding a Sale. Amount
+// may be left out when no money is paid back.
+type NewRefund struct {
+	Quantity int          `json:"quantity" validate:"gte=0"`
+	Amount   *money.Money `json:"amount"`
+	Reason   string       `json:"reason" validate:"required,max=500"`
+}
+
+// Void is what we require from clients when voiding a Sale.
+type Void struct {
+	Reason string `json:"reason" validate:"required,max=500"`
 }
@@ -0,0 +1,37 @@
+package product
+
+import (
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+)
+
+// Actions which can be performed on Products.
+const (
+	ActionUpdate    = "update"
+	ActionDelete    = "delete"
+	ActionSell      = "sell"
+	ActionRefund    = "refund"
+	ActionVoid      = "void"
+	ActionListTrash = "list_trash"
+	ActionRestore   = "restore"
+)
+
+// Policy decides who may act on Products. Users manage the Products they own
+// and admins manage everyone's. Only admins can see and restore the trash.
+var Policy = authz.Policy{
+	Kind: "product",
+	Rules: map[string]authz.Rule{
+		ActionUpdate:    authz.Any(authz.Owner, authz.Role(auth.RoleAdmin)),
+		ActionDelete:    authz.Any(authz.Owner, authz.Role(auth.RoleAdmin)),
+		ActionSell:      authz.Any(authz.Owner, authz.Role(auth.RoleAdmin)),
+		ActionRefund:    authz.Any(authz.Owner, authz.Role(auth.RoleAdmin)),
+		ActionVoid:      authz.Any(authz.Owner, authz.Role(auth.RoleAdmin)),
+		ActionListTrash: authz.Role(auth.RoleAdmin),
+		ActionRestore:   authz.Role(auth.RoleAdmin),
+	},
+}
+
+// resource describes p to the Policy.
+func (p *Product) resource() authz.Resource {
+	return authz.Resource{ID: p.ID, OwnerID: p.UserID}
+}
@@ -3,9 +3,15 @@ package product
 import (
 	"context"
 	"database/sql"
+	"net/http"
 	"time"
 
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+	"github.com/a2go/garagesale/internal/platform/blob"
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/a2go/garagesale/internal/platform/web"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -20,34 +26,127 @@ var (
 	// ErrInvalidID is used when an invalid UUID is provided.
 	ErrInvalidID = errors.New("ID is not in its proper form")
 
+	// ErrInvalidCursor is used when a page cursor was made for a different
+	// sort order than the one requested.
+	ErrInvalidCursor = errors.New("cursor does not match the sort order")
+
+	// ErrInsufficientStock is used when a sale is for more units of a
+	// Product than remain unsold.
+	ErrInsufficientStock = errors.New("not enough stock to complete the sale")
+
+	// ErrInvalidQuantity is used when a sale is for fewer than one unit.
+	ErrInvalidQuantity = errors.New("sale quantity must be at least 1")
+
+	// ErrUnknownCategory is used when a Product is filed under a category
+	// which does not exist.
+	ErrUnknownCategory = errors.New("category does not exist")
+
+	// ErrCurrencyMismatch is used when an amount of money for a Product is
+	// not in the currency of the Product.
+	ErrCurrencyMismatch = errors.New("currency does not match the product")
+
 	// ErrForbidden occurs when a user tries to do something that is forbidden to
-	// them according to our access control policies.
-	ErrForbidden = errors.New("Attempted action is not allowed")
+	// them according to our access control policies. It is the same error as
+	// authz.ErrDenied so either can be used to detect a denial.
+	ErrForbidden = authz.ErrDenied
 )
 
-// List gets all Products from the database.
-func List(ctx context.Context, db *sqlx.DB) ([]Product, error) {
+func init() {
+
+	// Tell the web layer how to respond when these errors reach a handler.
+	web.RegisterError(ErrNotFound, http.StatusNotFound, "product_not_found")
+	web.RegisterError(ErrInvalidID, http.StatusBadRequest, "invalid_id")
+	web.RegisterError(ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor")
+	web.RegisterError(ErrUnknownCategory, http.StatusBadRequest, "unknown_category")
+	web.RegisterError(ErrInsufficientStock, http.StatusConflict, "insufficient_stock")
+	web.RegisterError(ErrInvalidQuantity, http.StatusBadRequest, "invalid_quantity")
+	web.RegisterError(ErrCurrencyMismatch, http.StatusBadRequest, "currency_mismatch")
+}
+
+// List gets a page of the Products which match f. Deleted Products are not
+// included. The returned cursor selects
+// the following page and is nil when there are no more Products.
+func List(ctx context.Context, db *sqlx.DB, f Filter, page database.Page) ([]Product, *database.Cursor, error) {
 	ctx, span := trace.StartSpan(ctx, "product.List")
 	defer span.End()
 
+	return list(ctx, db, f, page, false)
+}
+
+// ListTrash is like List but only gets Products which have been deleted.
+func ListTrash(ctx context.Context, db *sqlx.DB, f Filter, page database.Page) ([]Product, *database.Cursor, error) {
+	ctx, span := trace.StartSpan(ctx, "product.ListTrash")
+	defer span.End()
+
+	return list(ctx, db, f, page, true)
+}
+
+// list runs the query for List or ListTrash.
+func list(ctx context.Context, db *sqlx.DB, f Filter, page database.Page, trash bool) ([]Product, *database.Cursor, error) {
+	q, args, next, err := buildList(f, page, trash)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	products := []Product{}
-	const q = `SELECT
-			p.*,
-			COALESCE(SUM(s.quantity) ,0) AS sold,
-			COALESCE(SUM(s.paid), 0) AS revenue
-		FROM products AS p
-		LEFT JOIN sales AS s ON p.product_id = s.product_id
-		GROUP BY p.product_id`
+	if err := db.SelectContext(ctx, &products, q, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "selecting products")
+	}
+
+	if page.Limit <= 0 || len(products) <= page.Limit {
+		return products, nil, nil
+	}
+
+	products = products[:page.Limit]
+	return products, next(&products[len(products)-1]), nil
+}
+
+// StreamList is like List but returns a cursor which scans one *Product of
+// the page at a time instead of loading them all into memory. The cursor of
+// the following page is found first so it can be sent before the Products.
+// The caller must close the returned Rows.
+func StreamList(ctx context.Context, db *sqlx.DB, f Filter, page database.Page) (*database.Rows, *database.Cursor, error) {
+	ctx, span := trace.StartSpan(ctx, "product.StreamList")
+	defer span.End()
+
+	rest := database.Page{After: page.After}
+
+	var next *database.Cursor
+	if page.Limit > 0 {
+		q, args, cursor, err := buildList(f, rest, false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var ends []Product
+		if err := pageEnd(ctx, db, &ends, q, page.Limit, args...); err != nil {
+			return nil, nil, errors.Wrap(err, "finding end of product page")
+		}
+		if len(ends) == 2 {
+			next = cursor(&ends[0])
+		}
+	}
+
+	rest.Until = next
+	q, args, _, err := buildList(f, rest, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if next == nil {
+		q, args = limitQuery(q, page.Limit, args...)
+	}
 
-	if err := db.SelectContext(ctx, &products, q); err != nil {
-		return nil, errors.Wrap(err, "selecting products")
+	rows, err := db.QueryxContext(ctx, q, args...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "selecting products")
 	}
 
-	return products, nil
+	return database.NewRows(rows, func() interface{} { return new(Product) }), next, nil
 }
 
-// Create adds a Product to the database. It returns the created Product with
-// fields like ID and DateCreated populated..
+// Create adds a Product to the database and starts its history. It returns
+// the created Product with fields like ID and DateCreated populated. Every
+// category must exist or it fails with ErrUnknownCategory.
 func Create(ctx context.Context, db *sqlx.DB, user auth.Claims, np NewProduct, now time.Time) (*Product, error) {
 	ctx, span := trace.StartSpan(ctx, "product.Create")
 	defer span.End()
@@ -57,17 +156,27 @@ func Create(ctx context.Context, db *sqlx.DB, user auth.Claims, np NewProduct, n
 		Name:        np.Name,
 		Cost:        np.Cost,
 		Quantity:    np.Quantity,
+		Revenue:     money.Money{Currency: np.Cost.Currency},
 		UserID:      user.Subject,
 		DateCreated: now.UTC(),
 		DateUpdated: now.UTC(),
+		Categories:  normalizeIDs(np.CategoryIDs),
+		Tags:        normalizeTags(np.Tags),
+		Images:      Images{},
 	}
 
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
 	const q = `
 		INSERT INTO products
 		(product_id, user_id, name, cost, quantity, date_created, date_updated)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
-	_, err := db.ExecContext(ctx, q,
+	_, err = tx.ExecContext(ctx, q,
 		p.ID, p.UserID,
 		p.Name, p.Cost, p.Quantity,
 		p.DateCreated, p.DateUpdated)
@@ -75,30 +184,53 @@ func Create(ctx context.Context, db *sqlx.DB, user auth.Claims, np NewProduct, n
 		return nil, errors.Wrap(err, "inserting product")
 	}
 
+	if err := setCategories(ctx, tx, p.ID, p.Categories); err != nil {
+		return nil, err
+	}
+	if err := setTags(ctx, tx, p.ID, p.Tags); err != nil {
+		return nil, err
+	}
+
+	if err := record(ctx, tx, user, p.ID, HistoryCreate, nil, &p, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing product")
+	}
+
 	return &p, nil
 }
 
-// Get finds the product identified by a given ID.
+// Get finds the product identified by a given ID. Deleted Products are not
+// found.
 func Get(ctx context.Context, db *sqlx.DB, id string) (*Product, error) {
 	ctx, span := trace.StartSpan(ctx, "product.Get")
 	defer span.End()
 
-	if _, err := uuid.Parse(id); err != nil {
-		return nil, ErrInvalidID
+	p, err := get(ctx, db, id)
+	if err != nil {
+		return nil, err
 	}
+	if p.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	return p, nil
+}
 
+// get finds the product identified by a given ID even if it is in the trash.
+// It can run in or outside of a transaction.
+func get(ctx context.Context, q sqlx.QueryerContext, id string) (*Product, error) {
 	var p Product
 
-	const q = `SELECT
-			p.*,
-			COALESCE(SUM(s.quantity), 0) AS sold,
-			COALESCE(SUM(s.paid), 0) AS revenue
+	const getQ = `SELECT ` + productColumns + `
 		FROM products AS p
-		LEFT JOIN sales AS s ON p.product_id = s.product_id
+		LEFT JOIN ` + netSales + ` AS s ON p.product_id = s.product_id
 		WHERE p.product_id = $1
 		GROUP BY p.product_id`
 
-	if err := db.GetContext(ctx, &p, q, id); err != nil {
+	if err := sqlx.GetContext(ctx, q, &p, getQ, id); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
 		}
@@ -109,34 +241,63 @@ func Get(ctx context.Context, db *sqlx.DB, id string) (*Product, error) {
 	return &p, nil
 }
 
+// getForUpdate locks the product identified by a given ID for the rest of tx
+// and then gets it, even if it is in the trash. Changes made while holding
+// the lock are applied, and added to the history, one at a time.
+func getForUpdate(ctx context.Context, tx *sqlx.Tx, id string) (*Product, error) {
+	var locked string
+	const q = `SELECT product_id FROM products WHERE product_id = $1 FOR UPDATE`
+	if err := tx.GetContext(ctx, &locked, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "locking product %s", id)
+	}
+
+	return get(ctx, tx, id)
+}
+
 // Update modifies data about a Product. It will error if the specified ID is
-// invalid or does not reference an existing Product.
+// invalid or does not reference an existing Product. The currency of a
+// Product cannot be changed since its sales were paid in it, so a new Cost in
+// another currency fails with ErrCurrencyMismatch. The change is added to the
+// Product's history.
 func Update(ctx context.Context, db *sqlx.DB, user auth.Claims, id string, update UpdateProduct, now time.Time) error {
 	ctx, span := trace.StartSpan(ctx, "product.Update")
 	defer span.End()
 
-	p, err := Get(ctx, db, id)
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	before, err := getForUpdate(ctx, tx, id)
 	if err != nil {
 		return err
 	}
+	if before.DeletedAt != nil {
+		return ErrNotFound
+	}
 
-	// If you do not have the admin role ...
-	// and you are not the owner of this product ...
-	// then get outta here!
-	if !user.HasRole(auth.RoleAdmin) && p.UserID != user.Subject {
-		return ErrForbidden
+	if err := Policy.Check(user, ActionUpdate, before.resource()); err != nil {
+		return err
 	}
 
+	p := *before
 	if update.Name != nil {
 		p.Name = *update.Name
 	}
 	if update.Cost != nil {
+		if update.Cost.Currency != p.Cost.Currency {
+			return ErrCurrencyMismatch
+		}
 		p.Cost = *update.Cost
 	}
 	if update.Quantity != nil {
 		p.Quantity = *update.Quantity
 	}
-	p.DateUpdated = now
+	p.DateUpdated = now.UTC()
 
 	const q = `UPDATE products SET
 		"name" = $2,
@@ -144,7 +305,7 @@ func Update(ctx context.Context, db *sqlx.DB, user auth.Claims, id string, updat
 		"quantity" = $4,
 		"date_updated" = $5
 		WHERE product_id = $1`
-	_, err = db.ExecContext(ctx, q, id,
+	_, err = tx.ExecContext(ctx, q, id,
 		p.Name, p.Cost,
 		p.Quantity, p.DateUpdated,
 	)
@@ -152,23 +313,174 @@ func Update(ctx context.Context, db *sqlx.DB, user auth.Claims, id string, updat
 		return errors.Wrap(err, "updating product")
 	}
 
+	if update.CategoryIDs != nil {
+		if err := setCategories(ctx, tx, id, normalizeIDs(*update.CategoryIDs)); err != nil {
+			return err
+		}
+	}
+	if update.Tags != nil {
+		if err := setTags(ctx, tx, id, normalizeTags(*update.Tags)); err != nil {
+			return err
+		}
+	}
+
+	after, err := get(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := record(ctx, tx, user, id, HistoryUpdate, before, after, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing product update")
+	}
+
 	return nil
 }
 
-// Delete removes the product identified by a given ID.
-func Delete(ctx context.Context, db *sqlx.DB, id string) error {
+// Delete moves the product identified by a given ID to the trash. It is
+// hidden from other queries but keeps its sales until it is purged. Deleting
+// a Product which is already deleted does nothing.
+func Delete(ctx context.Context, db *sqlx.DB, user auth.Claims, id string, now time.Time) error {
 	ctx, span := trace.StartSpan(ctx, "product.Delete")
 	defer span.End()
 
-	if _, err := uuid.Parse(id); err != nil {
-		return ErrInvalidID
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	before, err := getForUpdate(ctx, tx, id)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	if before.DeletedAt != nil {
+		return nil
+	}
+
+	if err := Policy.Check(user, ActionDelete, before.resource()); err != nil {
+		return err
 	}
 
-	const q = `DELETE FROM products WHERE product_id = $1`
+	after := *before
+	deleted := now.UTC()
+	after.DeletedAt = &deleted
 
-	if _, err := db.ExecContext(ctx, q, id); err != nil {
+	const q = `UPDATE products SET deleted_at = $2 WHERE product_id = $1`
+
+	if _, err := tx.ExecContext(ctx, q, id, after.DeletedAt); err != nil {
 		return errors.Wrapf(err, "deleting product %s", id)
 	}
 
+	if err := record(ctx, tx, user, id, HistoryDelete, before, &after, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing product delete")
+	}
+
+	return nil
+}
+
+// Restore takes the product identified by a given ID out of the trash. It
+// fails with ErrNotFound if the Product is not in the trash.
+func Restore(ctx context.Context, db *sqlx.DB, user auth.Claims, id string, now time.Time) error {
+	ctx, span := trace.StartSpan(ctx, "product.Restore")
+	defer span.End()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	before, err := getForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	after := *before
+	after.DeletedAt = nil
+
+	const q = `UPDATE products SET deleted_at = NULL WHERE product_id = $1`
+
+	if _, err := tx.ExecContext(ctx, q, id); err != nil {
+		return errors.Wrapf(err, "restoring product %s", id)
+	}
+
+	if err := record(ctx, tx, user, id, HistoryRestore, before, &after, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing product restore")
+	}
+
 	return nil
 }
+
+// Purge permanently removes Products which were deleted before the given
+// time, along with their sales and images. Their history is kept. Products with a sale which is part
+// of an order stay in the trash so the order still adds up. It returns how
+// many Products were removed. Image files are removed from store after the Products are gone so
+// a failure there leaves unused files rather than broken images.
+func Purge(ctx context.Context, db *sqlx.DB, store blob.Store, before time.Time) (int64, error) {
+	ctx, span := trace.StartSpan(ctx, "product.Purge")
+	defer span.End()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	// purgeable selects the Products in the trash which no order refers to.
+	const purgeable = `SELECT p.product_id FROM products AS p
+		WHERE p.deleted_at < $1 AND NOT EXISTS (
+			SELECT 1 FROM sales AS s
+			JOIN order_lines AS ol ON ol.sale_id = s.sale_id
+			WHERE s.product_id = p.product_id
+		)`
+
+	var images []Image
+	const imagesQ = `SELECT key, thumbnail_key FROM product_images
+		WHERE product_id IN (` + purgeable + `)`
+	if err := tx.SelectContext(ctx, &images, imagesQ, before.UTC()); err != nil {
+		return 0, errors.Wrap(err, "selecting images to purge")
+	}
+
+	const q = `DELETE FROM products WHERE product_id IN (` + purgeable + `)`
+
+	res, err := tx.ExecContext(ctx, q, before.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "purging products")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging products")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "committing purge")
+	}
+
+	var keys []string
+	for _, img := range images {
+		keys = append(keys, img.Key, img.ThumbnailKey)
+	}
+	if err := removeBlobs(ctx, store, keys...); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
@@ -6,10 +6,13 @@ import (
 	"time"
 
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/platform/money"
 	"github.com/a2go/garagesale/internal/product"
 	"github.com/a2go/garagesale/internal/schema"
 	"github.com/a2go/garagesale/internal/tests"
 	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
 )
 
 func TestProducts(t *testing.T) {
@@ -18,7 +21,7 @@ func TestProducts(t *testing.T) {
 
 	newP := product.NewProduct{
 		Name:     "Comic Book",
-		Cost:     10,
+		Cost:     tests.USD(10),
 		Quantity: 55,
 	}
 	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
@@ -46,11 +49,13 @@ func TestProducts(t *testing.T) {
 
 	update := product.UpdateProduct{
 		Name: tests.StringPointer("Comics"),
-		Cost: tests.IntPointer(25),
+		Cost: tests.MoneyPointer(tests.USD(25)),
 	}
 	updatedTime := time.Date(2019, time.January, 1, 1, 1, 1, 0, time.UTC)
 
-	if err := product.Update(ctx, db, claims, p0.ID, update, updatedTime); err != nil {
+	// Times in other zones are stored as UTC.
+	est := time.FixedZone("EST", -5*60*60)
+	if err := product.Update(ctx, db, claims, p0.ID, update, updatedTime.In(est)); err != nil {
 		t.Fatalf("creating product p0: %s", err)
 	}
 
@@ -63,14 +68,36 @@ func TestProducts(t *testing.T) {
 	// and change just the fields we expect then diff it with what was saved.
 	want := *p0
 	want.Name = "Comics"
-	want.Cost = 25
+	want.Cost = tests.USD(25)
 	want.DateUpdated = updatedTime
 
 	if diff := cmp.Diff(want, *saved); diff != "" {
 		t.Fatalf("updated record did not match:\n%s", diff)
 	}
 
-	if err := product.Delete(ctx, db, p0.ID); err != nil {
+	// The currency of a product cannot be changed.
+	euros := product.UpdateProduct{Cost: &money.Money{Amount: 25, Currency: "EUR"}}
+	if err := product.Update(ctx, db, claims, p0.ID, euros, updatedTime); errors.Cause(err) != product.ErrCurrencyMismatch {
+		t.Fatalf("expected %v changing the currency, got %v", product.ErrCurrencyMismatch, err)
+	}
+
+	// A user who neither owns the product nor is an admin is refused.
+	stranger := auth.NewClaims(
+		"c5f7c9d1-4f2c-4a56-8d0e-7b4f3f1e9a21",
+		[]string{auth.RoleUser},
+		now, time.Hour,
+	)
+	if err := product.Update(ctx, db, stranger, p0.ID, update, updatedTime); errors.Cause(err) != product.ErrForbidden {
+		t.Fatalf("expected %v updating another user's product, got %v", product.ErrForbidden, err)
+	}
+	if err := product.Delete(ctx, db, stranger, p0.ID, updatedTime); errors.Cause(err) != product.ErrForbidden {
+		t.Fatalf("expected %v deleting another user's product, got %v", product.ErrForbidden, err)
+	}
+
+	// The owner can delete their product without being an admin.
+	owner := auth.NewClaims(claims.Subject, []string{auth.RoleUser}, now, time.Hour)
+	deletedTime := time.Date(2019, time.January, 2, 0, 0, 0, 0, time.UTC)
+	if err := product.Delete(ctx, db, owner, p0.ID, deletedTime); err != nil {
 		t.Fatalf("deleting product: %v", err)
 	}
 
@@ -78,6 +105,58 @@ func TestProducts(t *testing.T) {
 	if err == nil {
 		t.Fatalf("should not be able to retrieve deleted product")
 	}
+
+	trash, _, err := product.ListTrash(ctx, db, product.Filter{}, database.Page{})
+	if err != nil {
+		t.Fatalf("listing trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != p0.ID || trash[0].DeletedAt == nil {
+		t.Fatalf("expected deleted product in trash, got %+v", trash)
+	}
+
+	if err := product.Restore(ctx, db, claims, p0.ID, deletedTime); err != nil {
+		t.Fatalf("restoring product: %v", err)
+	}
+	if _, err := product.Get(ctx, db, p0.ID); err != nil {
+		t.Fatalf("getting restored product: %v", err)
+	}
+	if err := product.Restore(ctx, db, claims, p0.ID, deletedTime); errors.Cause(err) != product.ErrNotFound {
+		t.Fatalf("expected %v restoring a product not in the trash, got %v", product.ErrNotFound, err)
+	}
+
+	// Purging only removes products deleted before the cutoff.
+	if err := product.Delete(ctx, db, claims, p0.ID, deletedTime); err != nil {
+		t.Fatalf("deleting product: %v", err)
+	}
+	images, cleanup := tests.NewImageStore(t)
+	defer cleanup()
+
+	n, err := product.Purge(ctx, db, images, deletedTime)
+	if err != nil {
+		t.Fatalf("purging products: %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no products purged before deletion, got %d", n)
+	}
+	n, err = product.Purge(ctx, db, images, deletedTime.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("purging products: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 product purged, got %d", n)
+	}
+	if err := product.Restore(ctx, db, claims, p0.ID, deletedTime); errors.Cause(err) != product.ErrNotFound {
+		t.Fatalf("expected %v restoring a purged product, got %v", product.ErrNotFound, err)
+	}
+
+	// The history of a purged product is kept.
+	versions, _, err := product.History(ctx, db, p0.ID, database.Page{})
+	if err != nil {
+		t.Fatalf("getting history of a purged product: %s", err)
+	}
+	if n := len(versions); n == 0 || versions[n-1].Action != product.HistoryDelete {
+		t.Fatalf("expected the history to end with the delete, got %+v", versions)
+	}
 }
 
 func TestProductList(t *testing.T) {
@@ -88,11 +167,157 @@ func TestProductList(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	ps, err := product.List(context.Background(), db)
+	ps, next, err := product.List(context.Background(), db, product.Filter{}, database.Page{})
 	if err != nil {
 		t.Fatalf("listing products: %s", err)
 	}
 	if exp, got := 2, len(ps); exp != got {
 		t.Fatalf("expected product list size %v, got %v", exp, got)
 	}
+	if next != nil {
+		t.Fatalf("expected no next page, got cursor %v", next)
+	}
+
+	// Walk the list one product at a time using the cursors.
+	var paged []product.Product
+	page := database.Page{Limit: 1}
+	for {
+		p, next, err := product.List(context.Background(), db, product.Filter{}, page)
+		if err != nil {
+			t.Fatalf("listing page: %s", err)
+		}
+		paged = append(paged, p...)
+		if next == nil {
+			break
+		}
+		page.After = next
+	}
+	if diff := cmp.Diff(ps, paged); diff != "" {
+		t.Fatalf("paged products differ from full list. Diff:\n%s", diff)
+	}
+
+	// Seeded products: Comic Books cost 50 with 35 left, McDonalds Toys cost
+	// 75 with 117 left.
+	min60, max40 := 60, 40
+	filters := []struct {
+		name   string
+		filter product.Filter
+		want   []string
+	}{
+		{"name", product.Filter{Name: "comic"}, []string{"Comic Books"}},
+		{"name is literal", product.Filter{Name: "%"}, nil},
+		{"min cost", product.Filter{MinCost: &min60}, []string{"McDonalds Toys"}},
+		{"currency", product.Filter{Currency: "USD"}, []string{"Comic Books", "McDonalds Toys"}},
+		{"other currency", product.Filter{Currency: "EUR"}, nil},
+		{"max stock", product.Filter{MaxStock: &max40}, []string{"Comic Books"}},
+		{"sort desc", product.Filter{Sort: "-cost"}, []string{"McDonalds Toys", "Comic Books"}},
+		{"sort stock", product.Filter{Sort: "stock"}, []string{"Comic Books", "McDonalds Toys"}},
+		{"category", product.Filter{Category: "0e6f1a2b-3c4d-4e5f-9a6b-7c8d9e0f1a2b"}, []string{"Comic Books"}},
+		{"parent category", product.Filter{Category: "f3a1b2c4-5d6e-4f70-8a9b-0c1d2e3f4a5b"}, []string{"Comic Books", "McDonalds Toys"}},
+		{"tag", product.Filter{Tags: []string{"Vintage"}}, []string{"Comic Books"}},
+		{"every tag", product.Filter{Tags: []string{"vintage", "rare"}}, nil},
+	}
+	for _, tt := range filters {
+		var names []string
+		page := database.Page{Limit: 1}
+		for {
+			ps, next, err := product.List(context.Background(), db, tt.filter, page)
+			if err != nil {
+				t.Fatalf("%s: listing products: %s", tt.name, err)
+			}
+			for _, p := range ps {
+				names = append(names, p.Name)
+			}
+			if next == nil {
+				break
+			}
+			page.After = next
+		}
+		if diff := cmp.Diff(tt.want, names); diff != "" {
+			t.Fatalf("%s: filtered products differ. Diff:\n%s", tt.name, diff)
+		}
+	}
+
+	// Categories and tags are saved with a new product.
+	claims := auth.NewClaims(
+		"718ffbea-f4a1-4667-8ae3-b349da52675e",
+		[]string{auth.RoleAdmin, auth.RoleUser},
+		time.Now(), time.Hour,
+	)
+	np := product.NewProduct{
+		Name:        "Action Figure",
+		Cost:        tests.USD(30),
+		Quantity:    2,
+		CategoryIDs: []string{"9C8B7A6D-5E4F-4A3B-8C2D-1E0F9A8B7C6D"},
+		Tags:        []string{" Boxed", "vintage", "boxed"},
+	}
+	created, err := product.Create(context.Background(), db, claims, np, time.Now())
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	saved, err := product.Get(context.Background(), db, created.ID)
+	if err != nil {
+		t.Fatalf("getting product: %s", err)
+	}
+	if diff := cmp.Diff([]string{"9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"}, []string(saved.Categories)); diff != "" {
+		t.Fatalf("saved categories differ. Diff:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"boxed", "vintage"}, []string(saved.Tags)); diff != "" {
+		t.Fatalf("saved tags differ. Diff:\n%s", diff)
+	}
+
+	np.CategoryIDs = []string{"2bd3b2e5-c4a3-4a38-9e79-3f7fe8d0d0a5"}
+	if _, err := product.Create(context.Background(), db, claims, np, time.Now()); errors.Cause(err) != product.ErrUnknownCategory {
+		t.Fatalf("expected %v for a missing category, got %v", product.ErrUnknownCategory, err)
+	}
+	if err := product.Delete(context.Background(), db, claims, created.ID, time.Now()); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+
+	// A cursor only works with the sort it was made for.
+	_, next, err = product.List(context.Background(), db, product.Filter{Sort: "name"}, database.Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("listing products: %s", err)
+	}
+	_, _, err = product.List(context.Background(), db, product.Filter{Sort: "cost"}, database.Page{Limit: 1, After: next})
+	if errors.Cause(err) != product.ErrInvalidCursor {
+		t.Fatalf("expected %v for a mismatched cursor, got %v", product.ErrInvalidCursor, err)
+	}
+
+	// Streaming pages one product at a time gives the same products as
+	// listing them all.
+	all, _, err := product.List(context.Background(), db, product.Filter{Sort: "name"}, database.Page{})
+	if err != nil {
+		t.Fatalf("listing products: %s", err)
+	}
+	var want, streamed []string
+	for _, p := range all {
+		want = append(want, p.Name)
+	}
+	page = database.Page{Limit: 1}
+	for {
+		rows, next, err := product.StreamList(context.Background(), db, product.Filter{Sort: "name"}, page)
+		if err != nil {
+			t.Fatalf("streaming products: %s", err)
+		}
+		for rows.Next() {
+			v, err := rows.Value()
+			if err != nil {
+				t.Fatalf("scanning product: %s", err)
+			}
+			streamed = append(streamed, v.(*product.Product).Name)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("iterating products: %s", err)
+		}
+		rows.Close()
+
+		if next == nil {
+			break
+		}
+		page.After = next
+	}
+	if diff := cmp.Diff(want, streamed); diff != "" {
+		t.Fatalf("streamed products differ. Diff:\n%s", diff)
+	}
 }
@@ -0,0 +1,230 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Predefined errors for refunding and voiding Sales.
+var (
+	// ErrSaleNotFound is used when a specific Sale of a Product is requested
+	// but does not exist.
+	ErrSaleNotFound = errors.New("sale not found")
+
+	// ErrSaleVoided is used when changing a Sale which has been voided.
+	ErrSaleVoided = errors.New("sale has been voided")
+
+	// ErrInvalidRefund is used when a refund returns neither units nor money.
+	ErrInvalidRefund = errors.New("refund must return some units or some of the amount paid")
+
+	// ErrRefundTooLarge is used when a refund returns more units or money
+	// than remain of a Sale after its earlier Refunds.
+	ErrRefundTooLarge = errors.New("refund is more than what remains of the sale")
+)
+
+func init() {
+	web.RegisterError(ErrSaleNotFound, http.StatusNotFound, "sale_not_found")
+	web.RegisterError(ErrSaleVoided, http.StatusConflict, "sale_voided")
+	web.RegisterError(ErrInvalidRefund, http.StatusBadRequest, "invalid_refund")
+	web.RegisterError(ErrRefundTooLarge, http.StatusConflict, "refund_exceeds_sale")
+}
+
+// AddRefund gives back part of the Sale identified by saleID on behalf of
+// user, who must be allowed to refund sales of the Product by the Policy.
+// Refunded units go back into stock and the Sold and Revenue of the Product
+// are reduced. A Sale cannot be refunded for more than is left of it after
+// earlier Refunds and a voided Sale cannot be refunded at all. Money can only
+// be paid back in the currency of the Sale.
+func AddRefund(ctx context.Context, db *sqlx.DB, user auth.Claims, nr NewRefund, productID, saleID string, now time.Time) (*Refund, error) {
+	ctx, span := trace.StartSpan(ctx, "product.AddRefund")
+	defer span.End()
+
+	var amount money.Money
+	if nr.Amount != nil {
+		amount = *nr.Amount
+	}
+	if nr.Quantity < 0 || amount.Amount < 0 || nr.Quantity == 0 && amount.Amount == 0 {
+		return nil, ErrInvalidRefund
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	s, err := lockSale(ctx, tx, user, ActionRefund, productID, saleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.VoidedAt != nil {
+		return nil, ErrSaleVoided
+	}
+	if nr.Amount == nil {
+		amount.Currency = s.Paid.Currency
+	}
+	if amount.Currency != s.Paid.Currency {
+		return nil, ErrCurrencyMismatch
+	}
+	if nr.Quantity > s.Quantity-s.RefundedQuantity || amount.Amount > s.Paid.Amount-s.Refunded.Amount {
+		return nil, ErrRefundTooLarge
+	}
+
+	r := Refund{
+		ID:          uuid.New().String(),
+		SaleID:      saleID,
+		Quantity:    nr.Quantity,
+		Amount:      amount,
+		Reason:      nr.Reason,
+		UserID:      user.Subject,
+		DateCreated: now.UTC(),
+	}
+
+	const q = `INSERT INTO refunds
+		(refund_id, sale_id, quantity, amount, reason, user_id, date_created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = tx.ExecContext(ctx, q,
+		r.ID, r.SaleID, r.Quantity, r.Amount,
+		r.Reason, r.UserID, r.DateCreated,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting refund")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing refund")
+	}
+
+	return &r, nil
+}
+
+// ListRefunds gives all Refunds of a Sale in the order they were made.
+func ListRefunds(ctx context.Context, db *sqlx.DB, productID, saleID string) ([]Refund, error) {
+	ctx, span := trace.StartSpan(ctx, "product.ListRefunds")
+	defer span.End()
+
+	if err := exists(ctx, db, productID); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(saleID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var found bool
+	const saleQ = `SELECT EXISTS (
+		SELECT 1 FROM sales WHERE sale_id = $1 AND product_id = $2
+	)`
+	if err := db.GetContext(ctx, &found, saleQ, saleID, productID); err != nil {
+		return nil, errors.Wrap(err, "checking sale exists")
+	}
+	if !found {
+		return nil, ErrSaleNotFound
+	}
+
+	refunds := []Refund{}
+	const q = `SELECT * FROM refunds WHERE sale_id = $1 ORDER BY date_created, refund_id`
+	if err := db.SelectContext(ctx, &refunds, q, saleID); err != nil {
+		return nil, errors.Wrap(err, "selecting refunds")
+	}
+
+	return refunds, nil
+}
+
+// VoidSale cancels the Sale identified by saleID on behalf of user, who must
+// be allowed to void sales of the Product by the Policy. A voided Sale no
+// longer counts towards the Sold and Revenue of the Product, including any
+// part of it which was refunded. The Sale is kept with who voided it and why.
+func VoidSale(ctx context.Context, db *sqlx.DB, user auth.Claims, v Void, productID, saleID string, now time.Time) error {
+	ctx, span := trace.StartSpan(ctx, "product.VoidSale")
+	defer span.End()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	s, err := lockSale(ctx, tx, user, ActionVoid, productID, saleID)
+	if err != nil {
+		return err
+	}
+
+	if s.VoidedAt != nil {
+		return ErrSaleVoided
+	}
+
+	const q = `UPDATE sales SET
+		voided_at = $2,
+		voided_by = $3,
+		void_reason = $4
+		WHERE sale_id = $1`
+
+	if _, err := tx.ExecContext(ctx, q, saleID, now.UTC(), user.Subject, v.Reason); err != nil {
+		return errors.Wrap(err, "voiding sale")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing void")
+	}
+
+	return nil
+}
+
+// lockSale locks the Product identified by productID and its Sale identified
+// by saleID until tx ends, then checks user may perform action on the
+// Product. The Sale is returned with the totals of its Refunds.
+func lockSale(ctx context.Context, tx *sqlx.Tx, user auth.Claims, action, productID, saleID string) (*Sale, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(saleID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	p := Product{ID: productID}
+	const productQ = `SELECT user_id FROM products
+		WHERE product_id = $1 AND deleted_at IS NULL
+		FOR UPDATE`
+	if err := tx.QueryRowxContext(ctx, productQ, productID).Scan(&p.UserID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "locking product")
+	}
+
+	if err := Policy.Check(user, action, p.resource()); err != nil {
+		return nil, err
+	}
+
+	var s Sale
+	const saleQ = `SELECT * FROM sales
+		WHERE sale_id = $1 AND product_id = $2
+		FOR UPDATE`
+	if err := tx.GetContext(ctx, &s, saleQ, saleID, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSaleNotFound
+		}
+		return nil, errors.Wrap(err, "locking sale")
+	}
+
+	const refundedQ = `SELECT COALESCE(SUM(quantity), 0), COALESCE(SUM((amount).amount), 0)
+		FROM refunds WHERE sale_id = $1`
+	if err := tx.QueryRowxContext(ctx, refundedQ, saleID).Scan(&s.RefundedQuantity, &s.Refunded.Amount); err != nil {
+		return nil, errors.Wrap(err, "totaling refunds")
+	}
+	s.Refunded.Currency = s.Paid.Currency
+
+	return &s, nil
+}
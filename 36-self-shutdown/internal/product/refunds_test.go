@@ -0,0 +1,151 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/a2go/garagesale/internal/product"
+	"github.com/a2go/garagesale/internal/tests"
+	"github.com/pkg/errors"
+)
+
+func TestRefunds(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	owner := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, now, time.Hour)
+	other := auth.NewClaims(tests.AdminID, []string{auth.RoleUser}, now, time.Hour)
+
+	p, err := product.Create(ctx, db, owner, product.NewProduct{Name: "Puzzles", Cost: tests.USD(25), Quantity: 6}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	s, err := product.AddSale(ctx, db, owner, product.NewSale{Quantity: 6, Paid: tests.USD(150)}, p.ID, now)
+	if err != nil {
+		t.Fatalf("adding sale: %s", err)
+	}
+
+	// totals checks what the Product has sold after refunds and voids.
+	totals := func(sold, revenue int) {
+		t.Helper()
+
+		got, err := product.Get(ctx, db, p.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if got.Sold != sold || got.Revenue != tests.USD(revenue) {
+			t.Fatalf("expected %d sold for %d, got %d sold for %v", sold, revenue, got.Sold, got.Revenue)
+		}
+	}
+
+	{ // Refunds
+
+		nr := product.NewRefund{Quantity: 2, Amount: tests.MoneyPointer(tests.USD(50)), Reason: "wrong size"}
+		r, err := product.AddRefund(ctx, db, owner, nr, p.ID, s.ID, now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("refunding sale: %s", err)
+		}
+		if r.UserID != tests.UserID || r.Reason != "wrong size" {
+			t.Fatalf("expected the refund to record who made it and why, got %+v", r)
+		}
+		totals(4, 100)
+
+		// Refunded units are back in stock so they can be sold again.
+		if _, err := product.AddSale(ctx, db, owner, product.NewSale{Quantity: 2, Paid: tests.USD(40)}, p.ID, now.Add(time.Minute)); err != nil {
+			t.Fatalf("selling refunded units: %s", err)
+		}
+		totals(6, 140)
+
+		// A partial refund of the price returns no units.
+		nr = product.NewRefund{Amount: tests.MoneyPointer(tests.USD(10)), Reason: "scratched box"}
+		if _, err := product.AddRefund(ctx, db, owner, nr, p.ID, s.ID, now.Add(time.Hour)); err != nil {
+			t.Fatalf("refunding part of the price: %s", err)
+		}
+		totals(6, 130)
+
+		sales, _, err := product.ListSales(ctx, db, p.ID, database.Page{})
+		if err != nil {
+			t.Fatalf("listing sales: %s", err)
+		}
+		if sales[0].ID != s.ID || sales[0].RefundedQuantity != 2 || sales[0].Refunded != tests.USD(60) {
+			t.Fatalf("expected the sale to show its refunds, got %+v", sales[0])
+		}
+
+		refunds, err := product.ListRefunds(ctx, db, p.ID, s.ID)
+		if err != nil {
+			t.Fatalf("listing refunds: %s", err)
+		}
+		if len(refunds) != 2 || refunds[0].ID != r.ID {
+			t.Fatalf("expected 2 refunds starting with %s, got %+v", r.ID, refunds)
+		}
+	}
+
+	{ // Invalid refunds
+
+		invalid := []struct {
+			name string
+			user auth.Claims
+			nr   product.NewRefund
+			sale string
+			err  error
+		}{
+			{"nothing", owner, product.NewRefund{Reason: "none"}, s.ID, product.ErrInvalidRefund},
+			{"too many units", owner, product.NewRefund{Quantity: 5, Reason: "all"}, s.ID, product.ErrRefundTooLarge},
+			{"too much money", owner, product.NewRefund{Amount: tests.MoneyPointer(tests.USD(100)), Reason: "all"}, s.ID, product.ErrRefundTooLarge},
+			{"other currency", owner, product.NewRefund{Amount: &money.Money{Amount: 5, Currency: "EUR"}, Reason: "euros"}, s.ID, product.ErrCurrencyMismatch},
+			{"not the owner", other, product.NewRefund{Quantity: 1, Reason: "mine"}, s.ID, product.ErrForbidden},
+			{"unknown sale", owner, product.NewRefund{Quantity: 1, Reason: "who"}, "2bd3b2e5-c4a3-4a38-9e79-3f7fe8d0d0a5", product.ErrSaleNotFound},
+			{"malformed sale", owner, product.NewRefund{Quantity: 1, Reason: "what"}, "not-a-uuid", product.ErrInvalidID},
+		}
+		for _, tt := range invalid {
+			if _, err := product.AddRefund(ctx, db, tt.user, tt.nr, p.ID, tt.sale, now); errors.Cause(err) != tt.err {
+				t.Fatalf("%s: expected %v, got %v", tt.name, tt.err, err)
+			}
+		}
+	}
+
+	{ // Voids
+
+		if err := product.VoidSale(ctx, db, other, product.Void{Reason: "mine"}, p.ID, s.ID, now); errors.Cause(err) != product.ErrForbidden {
+			t.Fatalf("expected %v voiding as another user, got %v", product.ErrForbidden, err)
+		}
+
+		// Voiding removes what is left of the sale and keeps who voided it.
+		if err := product.VoidSale(ctx, db, owner, product.Void{Reason: "test sale"}, p.ID, s.ID, now.Add(2*time.Hour)); err != nil {
+			t.Fatalf("voiding sale: %s", err)
+		}
+		totals(2, 40)
+
+		sales, _, err := product.ListSales(ctx, db, p.ID, database.Page{})
+		if err != nil {
+			t.Fatalf("listing sales: %s", err)
+		}
+		if v := sales[0]; v.VoidedAt == nil || *v.VoidedBy != tests.UserID || *v.VoidReason != "test sale" {
+			t.Fatalf("expected the sale to be voided by the owner, got %+v", v)
+		}
+
+		if err := product.VoidSale(ctx, db, owner, product.Void{Reason: "again"}, p.ID, s.ID, now); errors.Cause(err) != product.ErrSaleVoided {
+			t.Fatalf("expected %v voiding twice, got %v", product.ErrSaleVoided, err)
+		}
+		nr := product.NewRefund{Quantity: 1, Reason: "after void"}
+		if _, err := product.AddRefund(ctx, db, owner, nr, p.ID, s.ID, now); errors.Cause(err) != product.ErrSaleVoided {
+			t.Fatalf("expected %v refunding a voided sale, got %v", product.ErrSaleVoided, err)
+		}
+
+		// The past state of the Product leaves out the voided sale.
+		past, err := product.AsOf(ctx, db, p.ID, now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("getting past product: %s", err)
+		}
+		if past.Sold != 2 || past.Revenue != tests.USD(40) {
+			t.Fatalf("expected 2 sold for 40 in the past, got %d sold for %v", past.Sold, past.Revenue)
+		}
+	}
+}
@@ -2,32 +2,103 @@ package product
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/database"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
 )
 
-// AddSale records a sales transaction for a single Product.
-func AddSale(ctx context.Context, db *sqlx.DB, ns NewSale, productID string, now time.Time) (*Sale, error) {
+// AddSale records a sales transaction for a single Product on behalf of user,
+// who must be allowed to sell it by the Policy. The Product is
+// locked while the sale is recorded so concurrent sales cannot together sell
+// more than its remaining stock. A sale larger than the remaining stock fails
+// with ErrInsufficientStock and one for no units with ErrInvalidQuantity. One
+// paid in another currency than the Product's fails with ErrCurrencyMismatch.
+// A malformed or unknown productID gives ErrInvalidID or ErrNotFound.
+func AddSale(ctx context.Context, db *sqlx.DB, user auth.Claims, ns NewSale, productID string, now time.Time) (*Sale, error) {
 	ctx, span := trace.StartSpan(ctx, "product.AddSale")
 	defer span.End()
 
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	s, err := Sell(ctx, tx, user, ns, productID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing sale")
+	}
+
+	return s, nil
+}
+
+// Sell records a Sale the same way as AddSale but as part of tx, so it can be
+// committed together with other changes. The Product stays locked until tx
+// ends.
+func Sell(ctx context.Context, tx *sqlx.Tx, user auth.Claims, ns NewSale, productID string, now time.Time) (*Sale, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	if ns.Quantity < 1 {
+		return nil, ErrInvalidQuantity
+	}
+
+	p := Product{ID: productID}
+	const lockQ = `SELECT cost, quantity, user_id FROM products
+		WHERE product_id = $1 AND deleted_at IS NULL
+		FOR UPDATE`
+	if err := tx.QueryRowxContext(ctx, lockQ, productID).Scan(&p.Cost, &p.Quantity, &p.UserID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "locking product")
+	}
+
+	if err := Policy.Check(user, ActionSell, p.resource()); err != nil {
+		return nil, err
+	}
+
+	if ns.Paid.Currency != p.Cost.Currency {
+		return nil, ErrCurrencyMismatch
+	}
+
+	var sold int
+	const soldQ = `SELECT COALESCE(SUM(s.quantity), 0) FROM ` + netSales + ` AS s
+		WHERE s.product_id = $1`
+	if err := tx.GetContext(ctx, &sold, soldQ, productID); err != nil {
+		return nil, errors.Wrap(err, "counting sold units")
+	}
+
+	if ns.Quantity > p.Quantity-sold {
+		return nil, ErrInsufficientStock
+	}
+
 	s := Sale{
 		ID:          uuid.New().String(),
 		ProductID:   productID,
 		Quantity:    ns.Quantity,
 		Paid:        ns.Paid,
-		DateCreated: now,
+		DateCreated: now.UTC(),
 	}
 
 	const q = `INSERT INTO sales
 		(sale_id, product_id, quantity, paid, date_created)
 		VALUES ($1, $2, $3, $4, $5)`
 
-	_, err := db.ExecContext(ctx, q,
+	_, err := tx.ExecContext(ctx, q,
 		s.ID, s.ProductID, s.Quantity,
 		s.Paid, s.DateCreated,
 	)
@@ -38,17 +109,218 @@ func AddSale(ctx context.Context, db *sqlx.DB, ns NewSale, productID string, now
 	return &s, nil
 }
 
-// ListSales gives all Sales for a Product.
-func ListSales(ctx context.Context, db *sqlx.DB, productID string) ([]Sale, error) {
+// netSales selects every Sale which has not been voided with its quantity and
+// paid reduced by its Refunds. Queries which total what has been sold join it
+// in place of the sales table.
+const netSales = `(
+		SELECT s.sale_id, s.product_id, s.date_created,
+			s.quantity - COALESCE(SUM(r.quantity), 0) AS quantity,
+			ROW(
+				(s.paid).amount - COALESCE(SUM((r.amount).amount), 0),
+				(s.paid).currency
+			)::monetary AS paid
+		FROM sales AS s
+		LEFT JOIN refunds AS r ON r.sale_id = s.sale_id
+		WHERE s.voided_at IS NULL
+		GROUP BY s.sale_id
+	)`
+
+// salesQuery selects the Sales for a Product in the order they were made,
+// with the totals of their Refunds. The %s is a condition which restricts the
+// Sales returned.
+const salesQuery = `SELECT s.*,
+		COALESCE(SUM(r.quantity), 0) AS refunded_quantity,
+		ROW(COALESCE(SUM((r.amount).amount), 0), (s.paid).currency)::monetary AS refunded
+	FROM sales AS s
+	LEFT JOIN refunds AS r ON r.sale_id = s.sale_id
+	WHERE s.product_id = $1 AND %s
+	GROUP BY s.sale_id
+	ORDER BY s.date_created, s.sale_id`
+
+// ListSales gives a page of Sales for a Product. The returned cursor selects
+// the following page and is nil when there are no more Sales. A malformed or
+// unknown productID gives ErrInvalidID or ErrNotFound.
+func ListSales(ctx context.Context, db *sqlx.DB, productID string, page database.Page) ([]Sale, *database.Cursor, error) {
 	ctx, span := trace.StartSpan(ctx, "product.ListSales")
 	defer span.End()
 
+	if err := exists(ctx, db, productID); err != nil {
+		return nil, nil, err
+	}
+	if err := checkCursor(page.After, saleSort, timeKey); err != nil {
+		return nil, nil, err
+	}
+
+	q, args := pageQuery(salesQuery, "s.date_created, s.sale_id", page, productID)
+
 	sales := []Sale{}
+	if err := db.SelectContext(ctx, &sales, q, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "selecting sales")
+	}
 
-	const q = `SELECT * FROM sales WHERE product_id = $1`
-	if err := db.SelectContext(ctx, &sales, q, productID); err != nil {
-		return nil, errors.Wrap(err, "selecting sales")
+	if page.Limit <= 0 || len(sales) <= page.Limit {
+		return sales, nil, nil
 	}
 
-	return sales, nil
+	sales = sales[:page.Limit]
+	return sales, saleCursor(&sales[len(sales)-1]), nil
+}
+
+// saleSort is the Sort of cursors made by ListSales.
+const saleSort = "date_created"
+
+// saleCursor makes the cursor of the page of Sales following s.
+func saleCursor(s *Sale) *database.Cursor {
+	return &database.Cursor{Sort: saleSort, Key: database.TimeKey(s.DateCreated), ID: s.ID}
+}
+
+// StreamSales is like ListSales but returns a cursor which scans one *Sale of
+// the page at a time instead of loading them all into memory. The cursor of
+// the following page is found first so it can be sent before the Sales. The
+// caller must close the returned Rows.
+func StreamSales(ctx context.Context, db *sqlx.DB, productID string, page database.Page) (*database.Rows, *database.Cursor, error) {
+	ctx, span := trace.StartSpan(ctx, "product.StreamSales")
+	defer span.End()
+
+	if err := exists(ctx, db, productID); err != nil {
+		return nil, nil, err
+	}
+	if err := checkCursor(page.After, saleSort, timeKey); err != nil {
+		return nil, nil, err
+	}
+
+	const keys = "s.date_created, s.sale_id"
+	rest := database.Page{After: page.After}
+
+	var next *database.Cursor
+	if page.Limit > 0 {
+		q, args := pageQuery(salesQuery, keys, rest, productID)
+
+		var ends []Sale
+		if err := pageEnd(ctx, db, &ends, q, page.Limit, args...); err != nil {
+			return nil, nil, errors.Wrap(err, "finding end of sales page")
+		}
+		if len(ends) == 2 {
+			next = saleCursor(&ends[0])
+		}
+	}
+
+	rest.Until = next
+	q, args := pageQuery(salesQuery, keys, rest, productID)
+	if next == nil {
+		q, args = limitQuery(q, page.Limit, args...)
+	}
+
+	rows, err := db.QueryxContext(ctx, q, args...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "selecting sales")
+	}
+
+	return database.NewRows(rows, func() interface{} { return new(Sale) }), next, nil
+}
+
+// exists checks that productID is well formed and identifies a Product which
+// has not been deleted.
+func exists(ctx context.Context, db *sqlx.DB, productID string) error {
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+
+	var found bool
+	const q = `SELECT EXISTS (
+		SELECT 1 FROM products WHERE product_id = $1 AND deleted_at IS NULL
+	)`
+	if err := db.GetContext(ctx, &found, q, productID); err != nil {
+		return errors.Wrap(err, "checking product exists")
+	}
+	if !found {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// checkCursor makes sure a page cursor was made for sort and holds a key
+// which valid accepts and a UUID, so a cursor from another listing or one
+// which was tampered with fails with ErrInvalidCursor rather than in the
+// database. A nil cursor is always fine.
+func checkCursor(c *database.Cursor, sort string, valid func(key string) bool) error {
+	if c == nil {
+		return nil
+	}
+	if c.Sort != sort || !valid(c.Key) {
+		return ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// intKey, floatKey, timeKey and uuidKey report whether a cursor key is
+// written in the form of their type.
+func intKey(key string) bool {
+	_, err := strconv.Atoi(key)
+	return err == nil
+}
+
+func floatKey(key string) bool {
+	_, err := strconv.ParseFloat(key, 32)
+	return err == nil
+}
+
+func timeKey(key string) bool {
+	_, err := time.Parse(time.RFC3339Nano, key)
+	return err == nil
+}
+
+func uuidKey(key string) bool {
+	_, err := uuid.Parse(key)
+	return err == nil
+}
+
+// pageQuery fills the condition in q so it starts after the page cursor and
+// ends with its Until cursor. The keys name the columns the query is ordered
+// by. When the page has a limit one extra row is requested, which shows
+// whether there is a following page. Any args already used by q come first.
+func pageQuery(q, keys string, page database.Page, args ...interface{}) (string, []interface{}) {
+	var conds []string
+	if page.After != nil {
+		args = append(args, page.After.Key, page.After.ID)
+		conds = append(conds, fmt.Sprintf("(%s) > ($%d, $%d)", keys, len(args)-1, len(args)))
+	}
+	if page.Until != nil {
+		args = append(args, page.Until.Key, page.Until.ID)
+		conds = append(conds, fmt.Sprintf("(%s) <= ($%d, $%d)", keys, len(args)-1, len(args)))
+	}
+	q = fmt.Sprintf(q, joinConds(conds))
+
+	if page.Limit > 0 {
+		q, args = limitQuery(q, page.Limit+1, args...)
+	}
+
+	return q, args
+}
+
+// limitQuery limits q to n rows. A limit of zero or less leaves it as it is.
+func limitQuery(q string, n int, args ...interface{}) (string, []interface{}) {
+	if n <= 0 {
+		return q, args
+	}
+	args = append(args, n)
+	return q + fmt.Sprintf(" LIMIT $%d", len(args)), args
+}
+
+// pageEnd finds the end of a page of limit rows by running q, the ordered
+// query for every row after the page's After cursor. The last row of the
+// page and the row after it are selected into dest, which must point to a
+// slice. There is a following page only when both are found.
+//
+// Reading the page itself up to the last row, rather than for limit rows,
+// means rows added in the meantime are not skipped by the following page.
+func pageEnd(ctx context.Context, db *sqlx.DB, dest interface{}, q string, limit int, args ...interface{}) error {
+	args = append(args, limit-1)
+	q += fmt.Sprintf(" LIMIT 2 OFFSET $%d", len(args))
+
+	return db.SelectContext(ctx, dest, q, args...)
 }
@@ -6,8 +6,11 @@ import (
 	"time"
 
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/platform/money"
 	"github.com/a2go/garagesale/internal/product"
 	"github.com/a2go/garagesale/internal/tests"
+	"github.com/pkg/errors"
 )
 
 func TestSales(t *testing.T) {
@@ -21,7 +24,7 @@ func TestSales(t *testing.T) {
 	// Create two products to work with.
 	newPuzzles := product.NewProduct{
 		Name:     "Puzzles",
-		Cost:     25,
+		Cost:     tests.USD(25),
 		Quantity: 6,
 	}
 	claims := auth.NewClaims(
@@ -37,7 +40,7 @@ func TestSales(t *testing.T) {
 
 	newToys := product.NewProduct{
 		Name:     "Toys",
-		Cost:     40,
+		Cost:     tests.USD(40),
 		Quantity: 3,
 	}
 	toys, err := product.Create(ctx, db, claims, newToys, now)
@@ -49,16 +52,16 @@ func TestSales(t *testing.T) {
 
 		ns := product.NewSale{
 			Quantity: 3,
-			Paid:     70,
+			Paid:     tests.USD(70),
 		}
 
-		s, err := product.AddSale(ctx, db, ns, puzzles.ID, now)
+		s, err := product.AddSale(ctx, db, claims, ns, puzzles.ID, now)
 		if err != nil {
 			t.Fatalf("adding sale: %s", err)
 		}
 
 		// Puzzles should show the 1 sale.
-		sales, err := product.ListSales(ctx, db, puzzles.ID)
+		sales, _, err := product.ListSales(ctx, db, puzzles.ID, database.Page{})
 		if err != nil {
 			t.Fatalf("listing sales: %s", err)
 		}
@@ -71,7 +74,7 @@ func TestSales(t *testing.T) {
 		}
 
 		// Toys should have 0 sales.
-		sales, err = product.ListSales(ctx, db, toys.ID)
+		sales, _, err = product.ListSales(ctx, db, toys.ID, database.Page{})
 		if err != nil {
 			t.Fatalf("listing sales: %s", err)
 		}
@@ -79,4 +82,74 @@ func TestSales(t *testing.T) {
 			t.Fatalf("expected sale list size %v, got %v", exp, got)
 		}
 	}
+
+	{ // Inventory
+
+		// Puzzles has 6 units and 3 are sold, so 4 more is too many.
+		ns := product.NewSale{Quantity: 4, Paid: tests.USD(100)}
+		if _, err := product.AddSale(ctx, db, claims, ns, puzzles.ID, now); errors.Cause(err) != product.ErrInsufficientStock {
+			t.Fatalf("expected %v overselling, got %v", product.ErrInsufficientStock, err)
+		}
+
+		ns = product.NewSale{Quantity: 0, Paid: tests.USD(0)}
+		if _, err := product.AddSale(ctx, db, claims, ns, puzzles.ID, now); errors.Cause(err) != product.ErrInvalidQuantity {
+			t.Fatalf("expected %v for no units, got %v", product.ErrInvalidQuantity, err)
+		}
+
+		ns = product.NewSale{Quantity: 1, Paid: money.Money{Amount: 25, Currency: "EUR"}}
+		if _, err := product.AddSale(ctx, db, claims, ns, puzzles.ID, now); errors.Cause(err) != product.ErrCurrencyMismatch {
+			t.Fatalf("expected %v paying in another currency, got %v", product.ErrCurrencyMismatch, err)
+		}
+
+		// Selling exactly what is left succeeds.
+		ns = product.NewSale{Quantity: 3, Paid: tests.USD(75)}
+		if _, err := product.AddSale(ctx, db, claims, ns, puzzles.ID, now); err != nil {
+			t.Fatalf("selling remaining stock: %s", err)
+		}
+	}
+
+	{ // Unknown products
+
+		ns := product.NewSale{Quantity: 1, Paid: tests.USD(10)}
+		if _, err := product.AddSale(ctx, db, claims, ns, "not-a-uuid", now); errors.Cause(err) != product.ErrInvalidID {
+			t.Fatalf("expected %v adding a sale, got %v", product.ErrInvalidID, err)
+		}
+
+		missing := "2bd3b2e5-c4a3-4a38-9e79-3f7fe8d0d0a5"
+		if _, err := product.AddSale(ctx, db, claims, ns, missing, now); errors.Cause(err) != product.ErrNotFound {
+			t.Fatalf("expected %v adding a sale, got %v", product.ErrNotFound, err)
+		}
+
+		if _, _, err := product.ListSales(ctx, db, "not-a-uuid", database.Page{}); errors.Cause(err) != product.ErrInvalidID {
+			t.Fatalf("expected %v listing sales, got %v", product.ErrInvalidID, err)
+		}
+		if _, _, err := product.ListSales(ctx, db, missing, database.Page{}); errors.Cause(err) != product.ErrNotFound {
+			t.Fatalf("expected %v listing sales, got %v", product.ErrNotFound, err)
+		}
+	}
+
+	{ // Cursors from other listings or which were tampered with
+
+		// The cursor List gives when sorting products by name.
+		byName := &database.Cursor{Sort: "name", Key: "Puzzles", ID: puzzles.ID}
+		cursors := []*database.Cursor{
+			byName,
+			{Sort: "date_created", Key: "yesterday", ID: puzzles.ID},
+			{Sort: "date_created", Key: "2019-01-01T00:00:00Z", ID: "not-a-uuid"},
+		}
+		for _, c := range cursors {
+			if _, _, err := product.ListSales(ctx, db, puzzles.ID, database.Page{After: c}); errors.Cause(err) != product.ErrInvalidCursor {
+				t.Fatalf("expected %v listing sales after %+v, got %v", product.ErrInvalidCursor, c, err)
+			}
+			if _, _, err := product.StreamSales(ctx, db, puzzles.ID, database.Page{After: c}); errors.Cause(err) != product.ErrInvalidCursor {
+				t.Fatalf("expected %v streaming sales after %+v, got %v", product.ErrInvalidCursor, c, err)
+			}
+		}
+		if _, _, err := product.List(ctx, db, product.Filter{Sort: "cost"}, database.Page{After: &database.Cursor{Sort: "cost", Key: "cheap", ID: puzzles.ID}}); errors.Cause(err) != product.ErrInvalidCursor {
+			t.Fatalf("expected %v listing products after a tampered cursor, got %v", product.ErrInvalidCursor, err)
+		}
+		if _, _, err := product.History(ctx, db, puzzles.ID, database.Page{After: byName}); errors.Cause(err) != product.ErrInvalidCursor {
+			t.Fatalf("expected %v getting history, got %v", product.ErrInvalidCursor, err)
+		}
+	}
 }
@@ -0,0 +1,87 @@
+package product
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Match is a Product found by Search. Rank scores how well it matches, higher
+// being better. Snippet is the Product name as HTML with the matching words
+// wrapped in <mark> tags.
+type Match struct {
+	Product
+	Rank    float64 `db:"rank" json:"rank"`
+	Snippet string  `db:"snippet" json:"snippet"`
+}
+
+// searchSort is the Sort of cursors made by Search.
+const searchSort = "rank"
+
+// searchQuery finds Products whose search column matches the query in $1.
+// The query is parsed with websearch_to_tsquery, which accepts anything a
+// user might type without syntax errors. The name is escaped before it is
+// highlighted so the snippet is safe to use as HTML. The placeholder is
+// filled with the page condition.
+const searchQuery = `SELECT * FROM (
+		SELECT ` + productColumns + `,
+			ts_rank(p.search, websearch_to_tsquery('english', $1)) AS rank,
+			ts_headline('english',
+				replace(replace(replace(p.name, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+				websearch_to_tsquery('english', $1),
+				'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'
+			) AS snippet
+		FROM products AS p
+		LEFT JOIN ` + netSales + ` AS s ON p.product_id = s.product_id
+		WHERE p.deleted_at IS NULL AND p.search @@ websearch_to_tsquery('english', $1)
+		GROUP BY p.product_id
+	) AS m
+	WHERE %s
+	ORDER BY m.rank DESC, m.product_id DESC`
+
+// Search gets a page of the Products whose names match query, best matches
+// first. Deleted Products are not included. The returned cursor selects the
+// following page and is nil when there are no more matches.
+func Search(ctx context.Context, db *sqlx.DB, query string, page database.Page) ([]Match, *database.Cursor, error) {
+	ctx, span := trace.StartSpan(ctx, "product.Search")
+	defer span.End()
+
+	args := []interface{}{query}
+	cond := "TRUE"
+	if page.After != nil {
+		if err := checkCursor(page.After, searchSort, floatKey); err != nil {
+			return nil, nil, err
+		}
+		args = append(args, page.After.Key, page.After.ID)
+		cond = "(m.rank, m.product_id) < ($2::real, $3::uuid)"
+	}
+
+	q := fmt.Sprintf(searchQuery, cond)
+	if page.Limit > 0 {
+		args = append(args, page.Limit+1)
+		q += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	matches := []Match{}
+	if err := db.SelectContext(ctx, &matches, q, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "searching products")
+	}
+
+	if page.Limit <= 0 || len(matches) <= page.Limit {
+		return matches, nil, nil
+	}
+
+	matches = matches[:page.Limit]
+	last := matches[len(matches)-1]
+	next := database.Cursor{
+		Sort: searchSort,
+		Key:  strconv.FormatFloat(last.Rank, 'g', -1, 32),
+		ID:   last.ID,
+	}
+	return matches, &next, nil
+}
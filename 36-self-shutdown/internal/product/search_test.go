@@ -0,0 +1,91 @@
+package product_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/database"
+	"github.com/a2go/garagesale/internal/product"
+	"github.com/a2go/garagesale/internal/tests"
+)
+
+func TestSearch(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	claims := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, now, time.Hour)
+
+	ids := make(map[string]string)
+	for _, name := range []string{"Vintage Comic Books", "Comic Strips", "Toy Robot", "<b>Comic</b> Posters", "Old Comics"} {
+		p, err := product.Create(ctx, db, claims, product.NewProduct{Name: name, Cost: tests.USD(10), Quantity: 1}, now)
+		if err != nil {
+			t.Fatalf("creating product %q: %s", name, err)
+		}
+		ids[name] = p.ID
+	}
+	if err := product.Delete(ctx, db, claims, ids["Old Comics"], now); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+
+	// Every word must match, in any form of the word.
+	matches, _, err := product.Search(ctx, db, "vintage comic", database.Page{})
+	if err != nil {
+		t.Fatalf("searching: %s", err)
+	}
+	if len(matches) != 1 || matches[0].ID != ids["Vintage Comic Books"] || matches[0].Rank <= 0 {
+		t.Fatalf("expected only Vintage Comic Books to match, got %+v", matches)
+	}
+	if want := "<mark>Vintage</mark> <mark>Comic</mark> Books"; matches[0].Snippet != want {
+		t.Fatalf("expected snippet %q, got %q", want, matches[0].Snippet)
+	}
+
+	// Deleted Products are not found and names are escaped in snippets.
+	matches, _, err = product.Search(ctx, db, "comic", database.Page{})
+	if err != nil {
+		t.Fatalf("searching: %s", err)
+	}
+	if len(matches) != 3 {
+		t.Fatalf("expected 3 matches, got %+v", matches)
+	}
+	for _, m := range matches {
+		if m.ID == ids["<b>Comic</b> Posters"] && strings.Contains(m.Snippet, "<b>") {
+			t.Fatalf("expected the name to be escaped in the snippet, got %q", m.Snippet)
+		}
+	}
+
+	// Paging through one match at a time gives the same matches in order.
+	var paged []product.Match
+	page := database.Page{Limit: 1}
+	for {
+		got, next, err := product.Search(ctx, db, "comic", page)
+		if err != nil {
+			t.Fatalf("searching page: %s", err)
+		}
+		paged = append(paged, got...)
+		if next == nil {
+			break
+		}
+		page.After = next
+	}
+	if len(paged) != len(matches) {
+		t.Fatalf("expected %d matches over all pages, got %d", len(matches), len(paged))
+	}
+	for i := range paged {
+		if paged[i].ID != matches[i].ID {
+			t.Fatalf("page %d: expected %s, got %s", i, matches[i].ID, paged[i].ID)
+		}
+	}
+
+	// Anything a user types is accepted, even if it is not valid tsquery
+	// syntax.
+	for _, q := range []string{`"unbalanced`, `comic & | !`, `-`, `the`} {
+		if _, _, err := product.Search(ctx, db, q, database.Page{}); err != nil {
+			t.Fatalf("searching for %q: %s", q, err)
+		}
+	}
+}
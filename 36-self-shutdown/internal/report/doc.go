@@ -0,0 +1,3 @@
+// Package report implements the business logic for reports which total
+// sales over periods of time.
+package report
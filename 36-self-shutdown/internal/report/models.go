@@ -0,0 +1,54 @@
+package report
+
+import (
+	"time"
+)
+
+// Intervals which sales can be bucketed by.
+const (
+	Hour  = "hour"
+	Day   = "day"
+	Week  = "week"
+	Month = "month"
+)
+
+// Filter selects the sales which are totaled in a report and how they are
+// bucketed. Its tags let it be bound from a query string with
+// web.DecodeQuery. Fields left at their zero value do not restrict anything.
+type Filter struct {
+
+	// Interval is the length of each bucket. The default is Day. Weeks start
+	// on Monday.
+	Interval string `query:"interval" validate:"omitempty,oneof=hour day week month"`
+
+	// TZ is the IANA name of the time zone buckets start in, for example
+	// "America/New_York". The default is UTC.
+	TZ string `query:"tz" validate:"max=64"`
+
+	// ProductID matches sales of that Product.
+	ProductID string `query:"product_id" validate:"omitempty,uuid"`
+
+	// UserID matches sales of Products owned by that user.
+	UserID string `query:"user_id" validate:"omitempty,uuid"`
+
+	// Currency matches sales paid in that currency.
+	Currency string `query:"currency" validate:"omitempty,iso4217"`
+
+	// From and To bound when a sale was made. From is inclusive and To is
+	// exclusive. When they are not set the report starts or ends with the
+	// first or last matching sale.
+	From *time.Time `query:"from"`
+	To   *time.Time `query:"to"`
+}
+
+// Bucket is the total of one measure of sales made from Start up to End.
+// Both times are in the time zone of the report. Buckets without sales have
+// a Value of zero. Amounts of money are totaled separately for each currency
+// they were paid in, which Currency names, so a report has a Bucket for every
+// currency in each interval. Currency is empty for other measures.
+type Bucket struct {
+	Start    time.Time `db:"start" json:"start"`
+	End      time.Time `db:"end" json:"end"`
+	Currency string    `db:"currency" json:"currency,omitempty"`
+	Value    int       `db:"value" json:"value"`
+}
@@ -0,0 +1,21 @@
+package report
+
+import (
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+)
+
+// Actions which can be performed on reports.
+const (
+	ActionView = "view"
+)
+
+// Policy decides who may see reports. The resource is the user whose
+// Products are reported on. Users see reports on their own Products and
+// admins see reports on anyone's.
+var Policy = authz.Policy{
+	Kind: "report",
+	Rules: map[string]authz.Rule{
+		ActionView: authz.Any(authz.Owner, authz.Role(auth.RoleAdmin)),
+	},
+}
@@ -0,0 +1,240 @@
+package report
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+	"github.com/a2go/garagesale/internal/platform/web"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrInvalidTimezone is used when a Filter names a time zone which is not
+	// in the IANA database.
+	ErrInvalidTimezone = errors.New("tz must be an IANA time zone name")
+
+	// ErrInvalidRange is used when a Filter ends before it starts.
+	ErrInvalidRange = errors.New("from must be before to")
+
+	// ErrRangeTooLarge is used when a Filter would give more than maxBuckets
+	// buckets. A range left open counts up to the first or last sale.
+	ErrRangeTooLarge = errors.New("date range has too many buckets for the interval")
+)
+
+func init() {
+
+	// Tell the web layer how to respond when these errors reach a handler.
+	web.RegisterError(ErrInvalidTimezone, http.StatusBadRequest, "invalid_timezone")
+	web.RegisterError(ErrInvalidRange, http.StatusBadRequest, "invalid_range")
+	web.RegisterError(ErrRangeTooLarge, http.StatusBadRequest, "range_too_large")
+}
+
+// maxBuckets limits how many buckets a report may have.
+const maxBuckets = 10000
+
+// intervals gives the shortest length of each interval. It is used to
+// estimate how many buckets a date range holds.
+var intervals = map[string]time.Duration{
+	Hour:  time.Hour,
+	Day:   24 * time.Hour,
+	Week:  7 * 24 * time.Hour,
+	Month: 28 * 24 * time.Hour,
+}
+
+// reportBuckets holds the common expressions of the report queries. The sold
+// expression has the sales matched by a Filter in local time, with refunds
+// counted against the bucket they were made in and voided sales left out.
+// The buckets expression lists every bucket in the range, even those without
+// sales.
+//
+// The parameters are the interval, the time zone, From, To, ProductID,
+// UserID and Currency, each of which but the first two may be NULL.
+const reportBuckets = `
+	WITH sold AS (
+		SELECT
+			date_trunc($1::text, t.date_created AT TIME ZONE 'UTC' AT TIME ZONE $2::text) AS local,
+			t.quantity, t.paid, t.currency, t.date_created
+		FROM (
+			SELECT s.product_id, s.quantity, (s.paid).amount AS paid,
+				(s.paid).currency AS currency, s.date_created
+			FROM sales AS s
+			WHERE s.voided_at IS NULL
+			UNION ALL
+			SELECT s.product_id, -r.quantity, -(r.amount).amount,
+				(r.amount).currency, r.date_created
+			FROM refunds AS r
+			JOIN sales AS s ON s.sale_id = r.sale_id
+			WHERE s.voided_at IS NULL
+		) AS t
+		JOIN products AS p ON p.product_id = t.product_id
+		WHERE ($3::timestamp IS NULL OR t.date_created >= $3::timestamp)
+			AND ($4::timestamp IS NULL OR t.date_created < $4::timestamp)
+			AND ($5::uuid IS NULL OR t.product_id = $5::uuid)
+			AND ($6::uuid IS NULL OR p.user_id = $6::uuid)
+			AND ($7::text IS NULL OR t.currency = $7::text)
+	),
+	buckets AS (
+		SELECT generate_series(
+			date_trunc($1::text, COALESCE(
+				$3::timestamp AT TIME ZONE 'UTC' AT TIME ZONE $2::text,
+				(SELECT MIN(local) FROM sold)
+			)),
+			COALESCE(
+				($4::timestamp AT TIME ZONE 'UTC' AT TIME ZONE $2::text) - interval '1 microsecond',
+				(SELECT MAX(local) FROM sold)
+			),
+			('1 ' || $1::text)::interval
+		) AS local
+	)`
+
+// boundsQuery finds when the first and last of the matched sales were made.
+// They are NULL when no sales match.
+const boundsQuery = reportBuckets + `
+	SELECT MIN(date_created), MAX(date_created) FROM sold`
+
+// unitsQuery totals the units sold in each bucket. Local times which are
+// skipped by a daylight saving change do not start a bucket.
+const unitsQuery = reportBuckets + `
+	SELECT
+		b.local AT TIME ZONE $2::text AS start,
+		(b.local + ('1 ' || $1::text)::interval) AT TIME ZONE $2::text AS "end",
+		COALESCE(SUM(sold.quantity), 0) AS value
+	FROM buckets AS b
+	LEFT JOIN sold ON sold.local = b.local
+	WHERE (b.local AT TIME ZONE $2::text) AT TIME ZONE $2::text = b.local
+	GROUP BY b.local
+	ORDER BY b.local`
+
+// revenueQuery totals the amount paid in each bucket for each currency. The
+// currencies are those of the matched sales, or the one in the Filter.
+const revenueQuery = reportBuckets + `,
+	currencies AS (
+		SELECT $7::text AS currency WHERE $7::text IS NOT NULL
+		UNION
+		SELECT DISTINCT currency FROM sold
+	)
+	SELECT
+		b.local AT TIME ZONE $2::text AS start,
+		(b.local + ('1 ' || $1::text)::interval) AT TIME ZONE $2::text AS "end",
+		c.currency,
+		COALESCE(SUM(sold.paid), 0) AS value
+	FROM buckets AS b
+	CROSS JOIN currencies AS c
+	LEFT JOIN sold ON sold.local = b.local AND sold.currency = c.currency
+	WHERE (b.local AT TIME ZONE $2::text) AT TIME ZONE $2::text = b.local
+	GROUP BY b.local, c.currency
+	ORDER BY b.local, c.currency`
+
+// Revenue totals the amount paid for the sales matched by f in buckets of
+// f.Interval, separately for each currency. Amounts in different currencies
+// are never added together. The report is made on behalf of user, who must be
+// allowed to view it by the Policy. Users who are not admins only see sales
+// of their own Products unless f names another owner.
+func Revenue(ctx context.Context, db *sqlx.DB, user auth.Claims, f Filter) ([]Bucket, error) {
+	ctx, span := trace.StartSpan(ctx, "report.Revenue")
+	defer span.End()
+
+	return report(ctx, db, user, f, revenueQuery)
+}
+
+// Units totals the number of units sold by the sales matched by f in all
+// currencies together. It otherwise works the same way as Revenue.
+func Units(ctx context.Context, db *sqlx.DB, user auth.Claims, f Filter) ([]Bucket, error) {
+	ctx, span := trace.StartSpan(ctx, "report.Units")
+	defer span.End()
+
+	return report(ctx, db, user, f, unitsQuery)
+}
+
+// report checks f and runs the report query q for it.
+func report(ctx context.Context, db *sqlx.DB, user auth.Claims, f Filter, q string) ([]Bucket, error) {
+	if f.Interval == "" {
+		f.Interval = Day
+	}
+	if f.TZ == "" {
+		f.TZ = "UTC"
+	}
+
+	// Local is the zone of this process, which the database knows nothing
+	// about.
+	loc, err := time.LoadLocation(f.TZ)
+	if err != nil || f.TZ == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return nil, ErrInvalidRange
+	}
+
+	if f.UserID == "" && !user.HasRole(auth.RoleAdmin) {
+		f.UserID = user.Subject
+	}
+	if err := Policy.Check(user, ActionView, authz.Resource{ID: f.UserID, OwnerID: f.UserID}); err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{
+		f.Interval,
+		f.TZ,
+		utc(f.From),
+		utc(f.To),
+		nullable(f.ProductID),
+		nullable(f.UserID),
+		nullable(f.Currency),
+	}
+
+	// A range left open runs up to the first or last matching sale, which
+	// must be found to know how many buckets the report has.
+	from, to := f.From, f.To
+	if from == nil || to == nil {
+		var first, last *time.Time
+		if err := db.QueryRowxContext(ctx, boundsQuery, args...).Scan(&first, &last); err != nil {
+			return nil, errors.Wrap(err, "finding first and last sales")
+		}
+		if from == nil {
+			from = first
+		}
+		if to == nil && last != nil {
+			end := last.Add(time.Microsecond)
+			to = &end
+		}
+	}
+	if from != nil && to != nil && to.Sub(*from)/intervals[f.Interval] > maxBuckets {
+		return nil, ErrRangeTooLarge
+	}
+
+	buckets := []Bucket{}
+	if err := db.SelectContext(ctx, &buckets, q, args...); err != nil {
+		return nil, errors.Wrap(err, "totaling sales")
+	}
+
+	for i := range buckets {
+		buckets[i].Start = buckets[i].Start.In(loc)
+		buckets[i].End = buckets[i].End.In(loc)
+	}
+
+	return buckets, nil
+}
+
+// utc gives t in UTC, which is how sales times are stored, or nil if t is
+// not set.
+func utc(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// nullable gives nil for an empty string so it is sent as NULL.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,205 @@
+package report_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/authz"
+	"github.com/a2go/garagesale/internal/platform/money"
+	"github.com/a2go/garagesale/internal/product"
+	"github.com/a2go/garagesale/internal/report"
+	"github.com/a2go/garagesale/internal/tests"
+	"github.com/pkg/errors"
+)
+
+func TestReports(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	now := time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	owner := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, now, time.Hour)
+	admin := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	puzzles, err := product.Create(ctx, db, owner, product.NewProduct{Name: "Puzzles", Cost: tests.USD(10), Quantity: 100}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	toys, err := product.Create(ctx, db, admin, product.NewProduct{Name: "Toys", Cost: tests.USD(40), Quantity: 100}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	euros := func(cents int) money.Money { return money.Money{Amount: cents, Currency: "EUR"} }
+	books, err := product.Create(ctx, db, admin, product.NewProduct{Name: "Books", Cost: euros(55), Quantity: 100}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	sales := []struct {
+		user    auth.Claims
+		product string
+		sale    product.NewSale
+		at      time.Time
+	}{
+		{owner, puzzles.ID, product.NewSale{Quantity: 1, Paid: tests.USD(10)}, now.Add(3 * time.Hour)},
+		{owner, puzzles.ID, product.NewSale{Quantity: 2, Paid: tests.USD(20)}, now.Add(12 * time.Hour)},
+		{owner, puzzles.ID, product.NewSale{Quantity: 3, Paid: tests.USD(30)}, now.Add(60 * time.Hour)},
+		{admin, toys.ID, product.NewSale{Quantity: 4, Paid: tests.USD(160)}, now.Add(12 * time.Hour)},
+		{admin, books.ID, product.NewSale{Quantity: 1, Paid: euros(55)}, now.Add(12 * time.Hour)},
+	}
+	for _, s := range sales {
+		if _, err := product.AddSale(ctx, db, s.user, s.sale, s.product, s.at); err != nil {
+			t.Fatalf("adding sale: %s", err)
+		}
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading time zone: %s", err)
+	}
+	day := func(loc *time.Location, month time.Month, d int) time.Time {
+		return time.Date(2019, month, d, 0, 0, 0, 0, loc)
+	}
+	from, to := day(time.UTC, time.February, 27), day(time.UTC, time.March, 5)
+
+	cases := []struct {
+		name       string
+		user       auth.Claims
+		units      bool
+		filter     report.Filter
+		starts     []time.Time
+		values     []int
+		currencies []string
+	}{
+		{
+			"users see their own products by default",
+			owner, true, report.Filter{},
+			[]time.Time{day(time.UTC, time.March, 1), day(time.UTC, time.March, 2), day(time.UTC, time.March, 3)},
+			[]int{3, 0, 3},
+			nil,
+		},
+		{
+			"buckets start at midnight in the time zone",
+			owner, true, report.Filter{TZ: "America/New_York"},
+			[]time.Time{day(newYork, time.February, 28), day(newYork, time.March, 1), day(newYork, time.March, 2), day(newYork, time.March, 3)},
+			[]int{1, 2, 0, 3},
+			nil,
+		},
+		{
+			"admins see every product",
+			admin, false, report.Filter{Currency: "USD"},
+			[]time.Time{day(time.UTC, time.March, 1), day(time.UTC, time.March, 2), day(time.UTC, time.March, 3)},
+			[]int{190, 0, 30},
+			[]string{"USD", "USD", "USD"},
+		},
+		{
+			"revenue is totaled for each currency",
+			admin, false, report.Filter{},
+			[]time.Time{day(time.UTC, time.March, 1), day(time.UTC, time.March, 1), day(time.UTC, time.March, 2), day(time.UTC, time.March, 2), day(time.UTC, time.March, 3), day(time.UTC, time.March, 3)},
+			[]int{55, 190, 0, 0, 0, 30},
+			[]string{"EUR", "USD", "EUR", "USD", "EUR", "USD"},
+		},
+		{
+			"units are totaled across currencies",
+			admin, true, report.Filter{},
+			[]time.Time{day(time.UTC, time.March, 1), day(time.UTC, time.March, 2), day(time.UTC, time.March, 3)},
+			[]int{8, 0, 3},
+			[]string{"", "", ""},
+		},
+		{
+			"filtered by product",
+			admin, false, report.Filter{ProductID: toys.ID},
+			[]time.Time{day(time.UTC, time.March, 1)},
+			[]int{160},
+			nil,
+		},
+		{
+			"a date range is filled with empty buckets",
+			owner, false, report.Filter{From: &from, To: &to},
+			[]time.Time{day(time.UTC, time.February, 27), day(time.UTC, time.February, 28), day(time.UTC, time.March, 1), day(time.UTC, time.March, 2), day(time.UTC, time.March, 3), day(time.UTC, time.March, 4)},
+			[]int{0, 0, 30, 0, 30, 0},
+			nil,
+		},
+		{
+			"weeks start on Monday",
+			owner, true, report.Filter{Interval: report.Week},
+			[]time.Time{day(time.UTC, time.February, 25)},
+			[]int{6},
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			run := report.Revenue
+			if tc.units {
+				run = report.Units
+			}
+
+			buckets, err := run(ctx, db, tc.user, tc.filter)
+			if err != nil {
+				t.Fatalf("running report: %s", err)
+			}
+			if len(buckets) != len(tc.starts) {
+				t.Fatalf("expected %d buckets, got %+v", len(tc.starts), buckets)
+			}
+			for i, b := range buckets {
+				if !b.Start.Equal(tc.starts[i]) || b.Start.Location().String() != tc.starts[i].Location().String() {
+					t.Fatalf("bucket %d: expected start %v, got %v", i, tc.starts[i], b.Start)
+				}
+				if b.Value != tc.values[i] {
+					t.Fatalf("bucket %d: expected value %d, got %d", i, tc.values[i], b.Value)
+				}
+				if tc.currencies != nil && b.Currency != tc.currencies[i] {
+					t.Fatalf("bucket %d: expected currency %q, got %q", i, tc.currencies[i], b.Currency)
+				}
+			}
+		})
+	}
+
+	// The hour skipped when clocks go forward does not start a bucket and the
+	// bucket before it is an hour long.
+	start := time.Date(2019, time.March, 10, 0, 0, 0, 0, newYork)
+	end := time.Date(2019, time.March, 10, 5, 0, 0, 0, newYork)
+	buckets, err := report.Units(ctx, db, owner, report.Filter{Interval: report.Hour, TZ: "America/New_York", From: &start, To: &end})
+	if err != nil {
+		t.Fatalf("running hourly report: %s", err)
+	}
+	if len(buckets) != 4 {
+		t.Fatalf("expected 4 hourly buckets, got %+v", buckets)
+	}
+	if got := buckets[1].End.Sub(buckets[1].Start); got != time.Hour {
+		t.Fatalf("expected the bucket before the change to last an hour, got %v", got)
+	}
+
+	{
+		// Users cannot see reports on other users' products and reports must
+		// describe a sensible range of time.
+		_, err := report.Revenue(ctx, db, owner, report.Filter{UserID: tests.AdminID})
+		if errors.Cause(err) != authz.ErrDenied {
+			t.Fatalf("expected %v reporting on another user, got %v", authz.ErrDenied, err)
+		}
+
+		long := from.AddDate(10, 0, 0)
+		ancient := time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)
+		invalid := []struct {
+			filter report.Filter
+			err    error
+		}{
+			{report.Filter{TZ: "Mars/Olympus_Mons"}, report.ErrInvalidTimezone},
+			{report.Filter{TZ: "Local"}, report.ErrInvalidTimezone},
+			{report.Filter{From: &to, To: &from}, report.ErrInvalidRange},
+			{report.Filter{Interval: report.Hour, From: &from, To: &long}, report.ErrRangeTooLarge},
+			{report.Filter{Interval: report.Hour, From: &ancient}, report.ErrRangeTooLarge},
+			{report.Filter{Interval: report.Hour, To: &long}, report.ErrRangeTooLarge},
+		}
+		for _, tc := range invalid {
+			if _, err := report.Units(ctx, db, owner, tc.filter); errors.Cause(err) != tc.err {
+				t.Fatalf("expected %v for %+v, got %v", tc.err, tc.filter, err)
+			}
+		}
+	}
+}
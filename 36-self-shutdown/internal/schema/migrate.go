@@ -68,6 +68,238 @@ ALTER TABLE products
 	ADD COLUMN user_id UUID DEFAULT '00000000-0000-0000-0000-000000000000'
 `,
 	},
+	{
+		Version:     5,
+		Description: "Add soft delete to products",
+		Script: `
+ALTER TABLE products
+	ADD COLUMN deleted_at TIMESTAMP
+`,
+	},
+	{
+		Version:     6,
+		Description: "Add categories and tags",
+		Script: `
+CREATE TABLE categories (
+	category_id  UUID,
+	parent_id    UUID,
+	name         TEXT,
+	date_created TIMESTAMP,
+	date_updated TIMESTAMP,
+
+	PRIMARY KEY (category_id),
+	FOREIGN KEY (parent_id) REFERENCES categories(category_id)
+);
+
+CREATE TABLE product_categories (
+	product_id  UUID,
+	category_id UUID,
+
+	PRIMARY KEY (product_id, category_id),
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE,
+	FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE CASCADE
+);
+
+CREATE TABLE tags (
+	tag_id UUID,
+	name   TEXT UNIQUE,
+
+	PRIMARY KEY (tag_id)
+);
+
+CREATE TABLE product_tags (
+	product_id UUID,
+	tag_id     UUID,
+
+	PRIMARY KEY (product_id, tag_id),
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE,
+	FOREIGN KEY (tag_id) REFERENCES tags(tag_id) ON DELETE CASCADE
+);`,
+	},
+	{
+		Version:     7,
+		Description: "Add product images",
+		Script: `
+CREATE TABLE product_images (
+	image_id      UUID,
+	product_id    UUID,
+	key           TEXT,
+	thumbnail_key TEXT,
+	url           TEXT,
+	thumbnail_url TEXT,
+	content_type  TEXT,
+	size          INT,
+	width         INT,
+	height        INT,
+	date_created  TIMESTAMP,
+
+	PRIMARY KEY (image_id),
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+);`,
+	},
+	{
+		Version:     8,
+		Description: "Add full-text search to products",
+		Script: `
+ALTER TABLE products
+	ADD COLUMN search TSVECTOR
+	GENERATED ALWAYS AS (to_tsvector('english', coalesce(name, ''))) STORED;
+
+CREATE INDEX products_search_idx ON products USING GIN (search);`,
+	},
+	{
+		Version:     9,
+		Description: "Add product history",
+		Script: `
+CREATE TABLE product_history (
+	product_id   UUID,
+	version      INT,
+	action       TEXT,
+	user_id      UUID,
+	changes      JSONB,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (product_id, version),
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+);
+
+-- Start the history of existing products with their current state, as if
+-- they were created that way, and record when deleted ones were deleted.
+INSERT INTO product_history (product_id, version, action, user_id, changes, date_created)
+SELECT p.product_id, 1, 'create', p.user_id, jsonb_build_object(
+		'name', jsonb_build_object('from', NULL, 'to', to_jsonb(p.name)),
+		'cost', jsonb_build_object('from', NULL, 'to', to_jsonb(p.cost)),
+		'quantity', jsonb_build_object('from', NULL, 'to', to_jsonb(p.quantity)),
+		'categories', jsonb_build_object('from', NULL, 'to', to_jsonb(ARRAY(
+			SELECT pc.category_id::text FROM product_categories AS pc
+			WHERE pc.product_id = p.product_id ORDER BY 1
+		))),
+		'tags', jsonb_build_object('from', NULL, 'to', to_jsonb(ARRAY(
+			SELECT t.name FROM product_tags AS pt
+			JOIN tags AS t ON t.tag_id = pt.tag_id
+			WHERE pt.product_id = p.product_id ORDER BY 1
+		)))
+	), p.date_created
+FROM products AS p;
+
+INSERT INTO product_history (product_id, version, action, user_id, changes, date_created)
+SELECT p.product_id, 2, 'delete', p.user_id, jsonb_build_object(
+		'deleted_at', jsonb_build_object('from', NULL, 'to', to_jsonb(p.deleted_at AT TIME ZONE 'UTC'))
+	), p.deleted_at
+FROM products AS p
+WHERE p.deleted_at IS NOT NULL;`,
+	},
+	{
+		Version:     10,
+		Description: "Add refunds and voided sales",
+		Script: `
+ALTER TABLE sales
+	ADD COLUMN voided_at   TIMESTAMP,
+	ADD COLUMN voided_by   UUID,
+	ADD COLUMN void_reason TEXT;
+
+CREATE TABLE refunds (
+	refund_id    UUID,
+	sale_id      UUID,
+	quantity     INT,
+	amount       INT,
+	reason       TEXT,
+	user_id      UUID,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (refund_id),
+	FOREIGN KEY (sale_id) REFERENCES sales(sale_id) ON DELETE CASCADE
+);
+
+CREATE INDEX refunds_sale_id_idx ON refunds (sale_id);`,
+	},
+	{
+		Version:     11,
+		Description: "Add orders",
+		Script: `
+CREATE TABLE orders (
+	order_id     UUID,
+	user_id      UUID,
+	total        INT,
+	paid         INT,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (order_id)
+);
+
+-- Each line of an order is a sale. The name and cost of the product are kept
+-- as they were when the order was made.
+CREATE TABLE order_lines (
+	order_id UUID,
+	line     INT,
+	sale_id  UUID,
+	name     TEXT,
+	cost     INT,
+
+	PRIMARY KEY (order_id, line),
+	UNIQUE (sale_id),
+	FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+	FOREIGN KEY (sale_id) REFERENCES sales(sale_id) ON DELETE CASCADE
+);`,
+	},
+	{
+		Version:     12,
+		Description: "Add currencies to amounts of money",
+		Script: `
+CREATE TYPE monetary AS (
+	amount   INT,
+	currency TEXT
+);
+
+-- Everything was priced and paid in US dollars before currencies were kept.
+ALTER TABLE products
+	ALTER COLUMN cost TYPE monetary USING ROW(cost, 'USD')::monetary;
+
+ALTER TABLE sales
+	ALTER COLUMN paid TYPE monetary USING ROW(paid, 'USD')::monetary;
+
+ALTER TABLE refunds
+	ALTER COLUMN amount TYPE monetary USING ROW(amount, 'USD')::monetary;
+
+ALTER TABLE orders
+	ALTER COLUMN total TYPE monetary USING ROW(total, 'USD')::monetary,
+	ALTER COLUMN paid TYPE monetary USING ROW(paid, 'USD')::monetary;
+
+ALTER TABLE order_lines
+	ALTER COLUMN cost TYPE monetary USING ROW(cost, 'USD')::monetary;
+
+-- Product history keeps costs in their JSON form, which now has a currency.
+UPDATE product_history SET changes = jsonb_set(changes, '{cost}', jsonb_build_object(
+		'from', CASE jsonb_typeof(changes->'cost'->'from')
+			WHEN 'number' THEN jsonb_build_object('amount', changes->'cost'->'from', 'currency', 'USD')
+			ELSE changes->'cost'->'from'
+		END,
+		'to', CASE jsonb_typeof(changes->'cost'->'to')
+			WHEN 'number' THEN jsonb_build_object('amount', changes->'cost'->'to', 'currency', 'USD')
+			ELSE changes->'cost'->'to'
+		END
+	))
+WHERE changes ? 'cost';`,
+	},
+	{
+		Version:     13,
+		Description: "Keep sales which are lines of an order",
+		Script: `
+-- An order stores its totals so losing one of its sales would leave it not
+-- adding up. Purging skips products sold in an order instead.
+ALTER TABLE order_lines
+	DROP CONSTRAINT order_lines_sale_id_fkey,
+	ADD FOREIGN KEY (sale_id) REFERENCES sales(sale_id) ON DELETE RESTRICT;`,
+	},
+	{
+		Version:     14,
+		Description: "Keep the history of purged products",
+		Script: `
+-- History is an audit trail so it outlives the product. Its product_id is
+-- part of the key and cannot be cleared, so the reference is dropped.
+ALTER TABLE product_history
+	DROP CONSTRAINT product_history_product_id_fkey;`,
+	},
 }
 
 // Migrate attempts to bring the schema for db up to date with the migrations
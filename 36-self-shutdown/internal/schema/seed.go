@@ -19,14 +19,40 @@ import (
 
 const seeds = `
 INSERT INTO products (product_id, name, cost, quantity, date_created, date_updated) VALUES
-	('a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 'Comic Books', 50, 42, '2019-01-01 00:00:01.000001+00', '2019-01-01 00:00:01.000001+00'),
-	('72f8b983-3eb4-48db-9ed0-e45cc6bd716b', 'McDonalds Toys', 75, 120, '2019-01-01 00:00:02.000001+00', '2019-01-01 00:00:02.000001+00')
+	('a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 'Comic Books', '(50,USD)', 42, '2019-01-01 00:00:01.000001+00', '2019-01-01 00:00:01.000001+00'),
+	('72f8b983-3eb4-48db-9ed0-e45cc6bd716b', 'McDonalds Toys', '(75,USD)', 120, '2019-01-01 00:00:02.000001+00', '2019-01-01 00:00:02.000001+00')
 	ON CONFLICT DO NOTHING;
 
 INSERT INTO sales (sale_id, product_id, quantity, paid, date_created) VALUES
-	('98b6d4b8-f04b-4c79-8c2e-a0aef46854b7', 'a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 2, 100, '2019-01-01 00:00:03.000001+00'),
-	('85f6fb09-eb05-4874-ae39-82d1a30fe0d7', 'a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 5, 250, '2019-01-01 00:00:04.000001+00'),
-	('a235be9e-ab5d-44e6-a987-fa1c749264c7', '72f8b983-3eb4-48db-9ed0-e45cc6bd716b', 3, 225, '2019-01-01 00:00:05.000001+00')
+	('98b6d4b8-f04b-4c79-8c2e-a0aef46854b7', 'a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 2, '(100,USD)', '2019-01-01 00:00:03.000001+00'),
+	('85f6fb09-eb05-4874-ae39-82d1a30fe0d7', 'a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 5, '(250,USD)', '2019-01-01 00:00:04.000001+00'),
+	('a235be9e-ab5d-44e6-a987-fa1c749264c7', '72f8b983-3eb4-48db-9ed0-e45cc6bd716b', 3, '(225,USD)', '2019-01-01 00:00:05.000001+00')
+	ON CONFLICT DO NOTHING;
+
+-- Create a small tree of categories and file the products under them.
+INSERT INTO categories (category_id, parent_id, name, date_created, date_updated) VALUES
+	('f3a1b2c4-5d6e-4f70-8a9b-0c1d2e3f4a5b', NULL, 'Collectibles', '2019-01-01 00:00:00', '2019-01-01 00:00:00'),
+	('0e6f1a2b-3c4d-4e5f-9a6b-7c8d9e0f1a2b', 'f3a1b2c4-5d6e-4f70-8a9b-0c1d2e3f4a5b', 'Comics', '2019-01-01 00:00:00', '2019-01-01 00:00:00'),
+	('9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d', 'f3a1b2c4-5d6e-4f70-8a9b-0c1d2e3f4a5b', 'Toys', '2019-01-01 00:00:00', '2019-01-01 00:00:00')
+	ON CONFLICT DO NOTHING;
+
+INSERT INTO product_categories (product_id, category_id) VALUES
+	('a2b0639f-2cc6-44b8-b97b-15d69dbb511e', '0e6f1a2b-3c4d-4e5f-9a6b-7c8d9e0f1a2b'),
+	('72f8b983-3eb4-48db-9ed0-e45cc6bd716b', '9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d')
+	ON CONFLICT DO NOTHING;
+
+INSERT INTO tags (tag_id, name) VALUES
+	('5b2e8f0c-7a1d-4c3e-9f6a-2d4b8e1c7a90', 'vintage')
+	ON CONFLICT DO NOTHING;
+
+INSERT INTO product_tags (product_id, tag_id) VALUES
+	('a2b0639f-2cc6-44b8-b97b-15d69dbb511e', '5b2e8f0c-7a1d-4c3e-9f6a-2d4b8e1c7a90')
+	ON CONFLICT DO NOTHING;
+
+-- Start the history of the products with their creation.
+INSERT INTO product_history (product_id, version, action, user_id, changes, date_created) VALUES
+	('a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 1, 'create', '00000000-0000-0000-0000-000000000000', '{"name": {"from": null, "to": "Comic Books"}, "cost": {"from": null, "to": {"amount": 50, "currency": "USD"}}, "quantity": {"from": null, "to": 42}, "categories": {"from": null, "to": ["0e6f1a2b-3c4d-4e5f-9a6b-7c8d9e0f1a2b"]}, "tags": {"from": null, "to": ["vintage"]}}', '2019-01-01 00:00:01.000001+00'),
+	('72f8b983-3eb4-48db-9ed0-e45cc6bd716b', 1, 'create', '00000000-0000-0000-0000-000000000000', '{"name": {"from": null, "to": "McDonalds Toys"}, "cost": {"from": null, "to": {"amount": 75, "currency": "USD"}}, "quantity": {"from": null, "to": 120}, "categories": {"from": null, "to": ["9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"]}, "tags": {"from": null, "to": []}}', '2019-01-01 00:00:02.000001+00')
 	ON CONFLICT DO NOTHING;
 
 -- Create admin and regular User with password "gophers"
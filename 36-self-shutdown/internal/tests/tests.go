@@ -4,14 +4,17 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"io/ioutil"
 	"log"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/blob"
 	"github.com/a2go/garagesale/internal/platform/database"
 	"github.com/a2go/garagesale/internal/platform/database/databasetest"
+	"github.com/a2go/garagesale/internal/platform/money"
 	"github.com/a2go/garagesale/internal/schema"
 	"github.com/a2go/garagesale/internal/user"
 	"github.com/jmoiron/sqlx"
@@ -84,6 +87,30 @@ func NewUnit(t *testing.T) (*sqlx.DB, func()) {
 	return db, teardown
 }
 
+// NewImageStore creates a blob store in a temporary directory which gives
+// URLs under /v1/images. It returns the store as well as a function to call
+// at the end of the test which removes the directory.
+func NewImageStore(t *testing.T) (*blob.Local, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "images")
+	if err != nil {
+		t.Fatalf("creating image directory: %v", err)
+	}
+
+	store, err := blob.NewLocal(dir, "/v1/images")
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("creating image store: %v", err)
+	}
+
+	teardown := func() {
+		os.RemoveAll(dir)
+	}
+
+	return store, teardown
+}
+
 // Test owns state for running and shutting down tests.
 type Test struct {
 	DB            *sqlx.DB
@@ -169,3 +196,14 @@ func StringPointer(s string) *string {
 func IntPointer(i int) *int {
 	return &i
 }
+
+// USD is a helper to get an amount of US dollars given in cents, which is the
+// currency of the seed data.
+func USD(cents int) money.Money {
+	return money.Money{Amount: cents, Currency: "USD"}
+}
+
+// MoneyPointer is a helper to get a *money.Money from a money.Money.
+func MoneyPointer(m money.Money) *money.Money {
+	return &m
+}
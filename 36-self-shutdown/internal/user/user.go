@@ -3,9 +3,11 @@ package user
 import (
 	"context"
 	"database/sql"
+	"net/http"
 	"time"
 
 	"github.com/a2go/garagesale/internal/platform/auth"
+	"github.com/a2go/garagesale/internal/platform/web"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -19,6 +21,12 @@ var (
 	ErrAuthenticationFailure = errors.New("Authentication failed")
 )
 
+func init() {
+
+	// Tell the web layer how to respond when these errors reach a handler.
+	web.RegisterError(ErrAuthenticationFailure, http.StatusUnauthorized, "authentication_failed")
+}
+
 // Create inserts a new user into the database.
 func Create(ctx context.Context, db *sqlx.DB, n NewUser, now time.Time) (*User, error) {
 	ctx, span := trace.StartSpan(ctx, "internal.user.Create")